@@ -0,0 +1,200 @@
+// Package archive extracts files from release archives.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedArchive means the archive format isn't recognised from its name.
+	ErrUnsupportedArchive = errors.New("unsupported archive format")
+	// ErrMemberNotFound means the archive doesn't contain a requested file.
+	ErrMemberNotFound = errors.New("archive member not found")
+	// ErrMemberTooLarge means a requested file is larger than MaxMemberSize.
+	ErrMemberTooLarge = errors.New("archive member too large")
+)
+
+// MaxMemberSize is the largest file that will be extracted, which guards against decompression bombs.
+const MaxMemberSize int64 = 1 << 30
+
+// Supported archive formats. Compressed tarballs are named after their compression format.
+const (
+	Tar    = "tar"
+	TarGz  = Tar + "." + Gzip
+	TarBz2 = Tar + "." + Bzip2
+	TarXz  = Tar + "." + Xz
+	TarZst = Tar + "." + Zstd
+	Zip    = "zip"
+)
+
+// Format returns the format of the archive called name, or an empty string if it isn't an archive.
+func Format(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return TarGz
+	case strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"), strings.HasSuffix(name, ".tbz"):
+		return TarBz2
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return TarXz
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return TarZst
+	case strings.HasSuffix(name, ".tar"):
+		return Tar
+	case strings.HasSuffix(name, ".zip"):
+		return Zip
+	}
+	return ""
+}
+
+// Member is a file extracted from an archive.
+type Member struct {
+	// Path is where the file was extracted to.
+	Path string
+	// Mode is the permissions the file has in the archive.
+	Mode fs.FileMode
+}
+
+// Extract extracts members from the archive at path, whose format is detected from name.
+//
+// Members are matched against the paths in the archive either exactly or as trailing path elements,
+// so that "savvy" matches "savvy_1.0.0_linux_amd64/savvy"; the first match wins. Only regular files
+// are extracted. Each member is written to the file returned by create, which Extract closes.
+//
+// The returned map holds the members that were extracted, even if an error is returned, so that
+// the caller can remove them.
+func Extract(path, name string, members []string, create func(member string) (*os.File, error)) (map[string]Member, error) {
+	e := &extractor{name: name, members: members, create: create, extracted: make(map[string]Member)}
+	var err error
+	switch format := Format(name); format {
+	case Tar, TarGz, TarBz2, TarXz, TarZst:
+		err = e.extractTar(path, strings.TrimPrefix(strings.TrimPrefix(format, Tar), "."))
+	case Zip:
+		err = e.extractZip(path)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnsupportedArchive, name)
+	}
+	if err != nil {
+		return e.extracted, err
+	}
+	for _, member := range members {
+		if _, ok := e.extracted[member]; !ok {
+			return e.extracted, fmt.Errorf("%w: %s in %s", ErrMemberNotFound, member, name)
+		}
+	}
+	return e.extracted, nil
+}
+
+type extractor struct {
+	name      string
+	members   []string
+	create    func(member string) (*os.File, error)
+	extracted map[string]Member
+}
+
+// extractTar extracts the tarball at path, which is compressed with compression unless it is empty.
+func (e *extractor) extractTar(path string, compression string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if compression != "" {
+		dr, err := Decompress(f, compression)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", e.name, err)
+		}
+		defer dr.Close()
+		r = dr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", e.name, err)
+		}
+		err = e.extract(hdr.Name, hdr.FileInfo().Mode(), func() (io.ReadCloser, error) {
+			return io.NopCloser(tr), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *extractor) extractZip(path string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", e.name, err)
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		if err := e.extract(zf.Name, zf.Mode(), zf.Open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extract extracts the file at archivePath if it matches a member that hasn't been extracted yet.
+func (e *extractor) extract(archivePath string, mode fs.FileMode, open func() (io.ReadCloser, error)) error {
+	member, ok := match(archivePath, e.members)
+	if !ok {
+		return nil
+	}
+	if _, done := e.extracted[member]; done {
+		return nil
+	}
+	if !mode.IsRegular() {
+		return fmt.Errorf("%s in %s is not a regular file", archivePath, e.name)
+	}
+
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := e.create(member)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	e.extracted[member] = Member{Path: f.Name(), Mode: mode.Perm()}
+
+	n, err := io.Copy(f, io.LimitReader(r, MaxMemberSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to extract %s from %s: %w", archivePath, e.name, err)
+	}
+	if n > MaxMemberSize {
+		return fmt.Errorf("%w: %s in %s exceeds %d bytes", ErrMemberTooLarge, archivePath, e.name, MaxMemberSize)
+	}
+	return f.Close()
+}
+
+// match returns the member that archivePath is, or ends with.
+func match(archivePath string, members []string) (string, bool) {
+	archivePath = path.Clean("/" + archivePath)
+	for _, member := range members {
+		// the leading slash makes the suffix match whole path elements only.
+		m := path.Clean("/" + member)
+		if strings.HasSuffix(archivePath, m) {
+			return member, true
+		}
+	}
+	return "", false
+}
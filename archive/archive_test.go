@@ -0,0 +1,135 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+)
+
+type file struct {
+	name string
+	mode fs.FileMode
+	body string
+}
+
+var releaseFiles = []file{
+	{name: "savvy_1.0.0_linux_amd64/", mode: fs.ModeDir | 0755},
+	{name: "savvy_1.0.0_linux_amd64/savvy", mode: 0755, body: "savvy binary"},
+	{name: "savvy_1.0.0_linux_amd64/savvyd", mode: 0750, body: "savvyd binary"},
+	{name: "savvy_1.0.0_linux_amd64/completions/savvy.zsh", mode: 0644, body: "#compdef savvy"},
+	{name: "savvy_1.0.0_linux_amd64/notsavvy", mode: 0755, body: "not savvy"},
+}
+
+// writeTar writes files to a tarball called name, compressed as its extension says.
+func writeTar(t *testing.T, name string, files []file) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch Format(name) {
+	case TarGz:
+		w = gzip.NewWriter(&buf)
+	case TarXz:
+		w, err = xz.NewWriter(&buf)
+	case TarZst:
+		w, err = zstd.NewWriter(&buf)
+	default:
+		t.Fatalf("can't write %s", name)
+	}
+	assert.NoError(t, err)
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: int64(f.mode.Perm()), Size: int64(len(f.body)), Typeflag: tar.TypeReg}
+		if f.mode.IsDir() {
+			hdr.Typeflag = tar.TypeDir
+		}
+		assert.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(f.body))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, w.Close())
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return path
+}
+
+func writeZip(t *testing.T, files []file) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &zip.FileHeader{Name: f.name, Method: zip.Deflate}
+		hdr.SetMode(f.mode)
+		w, err := zw.CreateHeader(hdr)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(f.body))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	path := filepath.Join(t.TempDir(), "savvy_windows_amd64.zip")
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return path
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, TarGz, Format("savvy_linux_amd64.tar.gz"))
+	assert.Equal(t, TarGz, Format("savvy_linux_amd64.TGZ"))
+	assert.Equal(t, TarBz2, Format("savvy_linux_amd64.tar.bz2"))
+	assert.Equal(t, TarXz, Format("savvy_linux_amd64.tar.xz"))
+	assert.Equal(t, TarZst, Format("savvy_linux_amd64.tar.zst"))
+	assert.Equal(t, Tar, Format("savvy_linux_amd64.tar"))
+	assert.Equal(t, Zip, Format("savvy_windows_amd64.zip"))
+	assert.Empty(t, Format("savvy_linux_amd64"))
+}
+
+func TestExtract(t *testing.T) {
+	archives := map[string]string{
+		"TarGz":  writeTar(t, "savvy_linux_amd64.tar.gz", releaseFiles),
+		"TarXz":  writeTar(t, "savvy_linux_amd64.tar.xz", releaseFiles),
+		"TarZst": writeTar(t, "savvy_linux_amd64.tar.zst", releaseFiles),
+		"Zip":    writeZip(t, releaseFiles),
+	}
+	for name, path := range archives {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			create := func(member string) (*os.File, error) {
+				return os.Create(filepath.Join(dir, filepath.Base(member)))
+			}
+
+			members, err := Extract(path, filepath.Base(path), []string{"savvy", "savvyd", "completions/savvy.zsh"}, create)
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]Member{
+				"savvy":                 {Path: filepath.Join(dir, "savvy"), Mode: 0755},
+				"savvyd":                {Path: filepath.Join(dir, "savvyd"), Mode: 0750},
+				"completions/savvy.zsh": {Path: filepath.Join(dir, "savvy.zsh"), Mode: 0644},
+			}, members)
+			data, err := os.ReadFile(filepath.Join(dir, "savvy"))
+			assert.NoError(t, err)
+			assert.Equal(t, "savvy binary", string(data))
+
+			t.Run("MissingMember", func(t *testing.T) {
+				_, err := Extract(path, filepath.Base(path), []string{"savvy", "missing"}, create)
+				assert.ErrorIs(t, err, ErrMemberNotFound)
+			})
+			t.Run("DirectoryMember", func(t *testing.T) {
+				_, err := Extract(path, filepath.Base(path), []string{"savvy_1.0.0_linux_amd64"}, create)
+				assert.Error(t, err)
+			})
+		})
+	}
+	t.Run("UnsupportedArchive", func(t *testing.T) {
+		_, err := Extract("savvy", "savvy", []string{"savvy"}, nil)
+		assert.ErrorIs(t, err, ErrUnsupportedArchive)
+	})
+}
@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// ErrUnsupportedCompression means a compression format isn't supported.
+var ErrUnsupportedCompression = errors.New("unsupported compression format")
+
+// Supported compression formats of single-file assets, which are also their extensions.
+const (
+	Gzip  = "gz"
+	Bzip2 = "bz2"
+	Xz    = "xz"
+	Zstd  = "zst"
+)
+
+// Compression returns the compression format of the single compressed file called name, e.g "gz" for
+// "savvy_linux_amd64.gz", or an empty string if it isn't compressed or is an archive.
+func Compression(name string) string {
+	if Format(name) != "" {
+		return ""
+	}
+	name = strings.ToLower(name)
+	for _, c := range []string{Gzip, Bzip2, Xz, Zstd} {
+		if strings.HasSuffix(name, "."+c) {
+			return c
+		}
+	}
+	return ""
+}
+
+// TrimCompression returns name without its compression extension, e.g "savvy_linux_amd64" for "savvy_linux_amd64.gz".
+func TrimCompression(name string) string {
+	if c := Compression(name); c != "" {
+		return name[:len(name)-len(c)-1]
+	}
+	return name
+}
+
+// Decompress returns a reader that decompresses r, which is compressed with compression.
+//
+// The reader doesn't limit the size of the decompressed data, so callers should.
+func Decompress(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case Gzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr, nil
+	case Bzip2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case Xz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	case Zstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedCompression, compression)
+}
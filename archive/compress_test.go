@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+)
+
+func TestCompression(t *testing.T) {
+	assert.Equal(t, Gzip, Compression("savvy_linux_amd64.gz"))
+	assert.Equal(t, Xz, Compression("savvy_linux_amd64.XZ"))
+	assert.Equal(t, Zstd, Compression("https://github.com/getsavvyinc/savvy-cli/releases/download/v0.1.0/savvy_linux_amd64.zst"))
+	assert.Equal(t, Bzip2, Compression("savvy_linux_amd64.bz2"))
+	assert.Equal(t, "", Compression("savvy_linux_amd64"))
+	assert.Equal(t, "", Compression("savvy_linux_amd64.tar.gz"))
+	assert.Equal(t, "", Compression("savvy_linux_amd64.tgz"))
+	// compressed tarballs are archives, rather than a compressed binary.
+	assert.Equal(t, "", Compression("savvy_linux_amd64.tar.xz"))
+	assert.Equal(t, "", Compression("savvy_linux_amd64.tar.zst"))
+	assert.Equal(t, "", Compression("savvy_linux_amd64.tar.bz2"))
+
+	assert.Equal(t, "savvy_linux_amd64", TrimCompression("savvy_linux_amd64.gz"))
+	assert.Equal(t, "savvy_linux_amd64.tar.gz", TrimCompression("savvy_linux_amd64.tar.gz"))
+}
+
+func TestDecompress(t *testing.T) {
+	want := "savvy binary"
+	compress := func(t *testing.T, newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+		var buf bytes.Buffer
+		w, err := newWriter(&buf)
+		assert.NoError(t, err)
+		_, err = io.WriteString(w, want)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+	// created with `printf 'savvy binary' | bzip2 -9`, since the standard library can't compress bzip2.
+	bz2, err := base64.StdEncoding.DecodeString("QlpoOTFBWSZTWceFHLkAAAORgEAAMCEZICAAMQZMQQDJ6guxNuiDxdyRThQkMeFHLkA=")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		compression string
+		data        []byte
+	}{
+		{compression: Gzip, data: compress(t, func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil })},
+		{compression: Xz, data: compress(t, func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) })},
+		{compression: Zstd, data: compress(t, func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) })},
+		{compression: Bzip2, data: bz2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.compression, func(t *testing.T) {
+			r, err := Decompress(bytes.NewReader(tc.data), tc.compression)
+			assert.NoError(t, err)
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, want, string(got))
+		})
+	}
+
+	t.Run("Corrupt", func(t *testing.T) {
+		_, err := Decompress(bytes.NewReader([]byte("savvy binary")), Gzip)
+		assert.Error(t, err)
+	})
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := Decompress(bytes.NewReader(nil), "lz4")
+		assert.ErrorIs(t, err, ErrUnsupportedCompression)
+	})
+}
@@ -0,0 +1,156 @@
+package checksum
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// Algorithm identifies the digest algorithm used by a checksum file.
+type Algorithm string
+
+const (
+	SHA256 Algorithm = "sha256"
+	SHA512 Algorithm = "sha512"
+	BLAKE3 Algorithm = "blake3"
+
+	// SHA1 and MD5 are recognised so that they can be refused.
+	SHA1 Algorithm = "sha1"
+	MD5  Algorithm = "md5"
+)
+
+// SupportedAlgorithms lists the algorithms that can be used to validate a download.
+var SupportedAlgorithms = []Algorithm{SHA256, SHA512, BLAKE3}
+
+var (
+	ErrWeakAlgorithm        = errors.New("weak checksum algorithm")
+	ErrUnsupportedAlgorithm = errors.New("unsupported checksum algorithm")
+)
+
+// IsWeak reports whether a is considered too weak to validate a download.
+func (a Algorithm) IsWeak() bool {
+	return a == SHA1 || a == MD5
+}
+
+// NewHash returns a hash.Hash computing a.
+func NewHash(a Algorithm) (hash.Hash, error) {
+	switch a {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	case BLAKE3:
+		return blake3.New(32, nil), nil
+	case SHA1, MD5:
+		return nil, fmt.Errorf("%w: %s", ErrWeakAlgorithm, a)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, a)
+}
+
+// digestSize returns the size in bytes of a digest computed with a.
+func digestSize(a Algorithm) int {
+	switch a {
+	case SHA512:
+		return sha512.Size
+	case SHA1:
+		return 20
+	case MD5:
+		return 16
+	}
+	return sha256.Size
+}
+
+// filenameHints maps the tokens used in checksum file names to the algorithm they hold.
+var filenameHints = []struct {
+	token     string
+	algorithm Algorithm
+}{
+	{"sha512", SHA512},
+	{"sha256", SHA256},
+	{"blake3", BLAKE3},
+	{"b3", BLAKE3},
+	{"sha1", SHA1},
+	{"md5", MD5},
+}
+
+// algorithmFromFilename infers the algorithm from well known checksum file names
+// such as SHA256SUMS, sha512sums.txt or tool_1.2.3_b3sums.txt, and from sidecar
+// extensions such as .sha256 or .sha512sum.
+//
+// It returns an empty Algorithm if the name carries no hint.
+func algorithmFromFilename(name string) Algorithm {
+	name = strings.TrimSuffix(strings.ToLower(path.Base(name)), ".txt")
+	for _, hint := range filenameHints {
+		sums := hint.token + "sums"
+		switch {
+		case name == sums,
+			strings.HasSuffix(name, "_"+sums),
+			strings.HasSuffix(name, "-"+sums),
+			strings.HasSuffix(name, "."+sums),
+			strings.HasSuffix(name, "."+hint.token),
+			strings.HasSuffix(name, "."+hint.token+"sum"):
+			return hint.algorithm
+		}
+	}
+	return ""
+}
+
+// isWellKnownChecksumFile reports whether name looks like a checksum file produced by
+// sha256sum, sha512sum, b3sum and friends.
+func isWellKnownChecksumFile(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(path.Base(name)), ".txt")
+	switch name {
+	case "sha256sums", "sha512sums", "b3sums", "blake3sums", "sha1sums", "md5sums":
+		return true
+	}
+	return false
+}
+
+// algorithmFromDigest infers the algorithm from the length of a hex encoded digest.
+//
+// SHA256 and BLAKE3 digests have the same length, so a 64 character digest is assumed
+// to be SHA256 unless the checksum file name says otherwise.
+func algorithmFromDigest(digest string) Algorithm {
+	switch len(digest) {
+	case 128:
+		return SHA512
+	case 64:
+		return SHA256
+	case 40:
+		return SHA1
+	case 32:
+		return MD5
+	}
+	return ""
+}
+
+// detectAlgorithm determines the algorithm for a checksum file named filename
+// whose first entry is digest.
+//
+// The file name takes precedence over the digest length. If neither carries a hint,
+// detectAlgorithm falls back to SHA256.
+func detectAlgorithm(filename string, digest string) (Algorithm, error) {
+	algorithm := algorithmFromFilename(filename)
+	if algorithm == "" {
+		algorithm = algorithmFromDigest(digest)
+	}
+	if algorithm == "" {
+		algorithm = SHA256
+	}
+	if algorithm.IsWeak() {
+		return "", fmt.Errorf("%w: %s", ErrWeakAlgorithm, algorithm)
+	}
+	return algorithm, nil
+}
+
+// digestEqual compares two hex encoded digests case-insensitively in constant time.
+func digestEqual(expected, actual string) bool {
+	return subtle.ConstantTimeCompare([]byte(strings.ToLower(expected)), []byte(strings.ToLower(actual))) == 1
+}
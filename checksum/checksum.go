@@ -1,15 +1,14 @@
 package checksum
 
 import (
-	"bufio"
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
-	"runtime"
 	"strings"
 
+	"github.com/getsavvyinc/upgrade-cli/platform"
 	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/transport"
 )
 
 type Downloader interface {
@@ -19,10 +18,17 @@ type Downloader interface {
 type Info struct {
 	// keyed on $binary_os_$arch
 	Checksums map[string]string
+	// Algorithm is the digest algorithm used for Checksums.
+	Algorithm Algorithm
+	// Sources holds the URL of the checksum file each entry of Checksums came from.
+	Sources map[string]string
 }
 
 type checksumDownloader struct {
 	assetSuffix string
+	maxFileSize int64
+	strategy    Strategy
+	client      *http.Client
 }
 
 type DownloadOpt func(*checksumDownloader)
@@ -33,9 +39,33 @@ func WithAssetSuffix(suffix string) DownloadOpt {
 	}
 }
 
+// WithMaxFileSize limits the size of the checksum file that will be downloaded.
+func WithMaxFileSize(size int64) DownloadOpt {
+	return func(c *checksumDownloader) {
+		c.maxFileSize = size
+	}
+}
+
+// WithStrategy sets how checksum files are chosen for an asset. The default is PreferSidecar.
+func WithStrategy(s Strategy) DownloadOpt {
+	return func(c *checksumDownloader) {
+		c.strategy = s
+	}
+}
+
+// WithHTTPClient sets the client used to download checksum files. It defaults to transport.NewClient.
+func WithHTTPClient(client *http.Client) DownloadOpt {
+	return func(c *checksumDownloader) {
+		c.client = client
+	}
+}
+
 func NewCheckSumDownloader(opts ...DownloadOpt) Downloader {
 	d := &checksumDownloader{
 		assetSuffix: "checksums.txt",
+		maxFileSize: DefaultMaxFileSize,
+		strategy:    PreferSidecar,
+		client:      transport.NewClient(),
 	}
 	for _, opt := range opts {
 		opt(d)
@@ -45,95 +75,83 @@ func NewCheckSumDownloader(opts ...DownloadOpt) Downloader {
 
 var ErrNoCheckSumAsset = errors.New("no checksum asset found")
 
+// Download downloads and merges every aggregate checksum file in assets.
 func (c *checksumDownloader) Download(ctx context.Context, assets []release.Asset) (*Info, error) {
-	// iterate through the assets and find the one that matches the os and arch
-	for _, asset := range assets {
-		if strings.HasSuffix(asset.BrowserDownloadURL, c.assetSuffix) {
-			checksums, err := downloadCheckSum(ctx, asset.BrowserDownloadURL)
-			if err != nil {
-				return nil, err
-			}
-			return checksums, nil
-		}
-	}
-	return nil, ErrNoCheckSumAsset
+	return c.Resolve(ctx, release.Asset{}, assets)
+}
+
+func (c *checksumDownloader) isAggregate(asset release.Asset) bool {
+	return strings.HasSuffix(asset.BrowserDownloadURL, c.assetSuffix) || isWellKnownChecksumFile(asset.BrowserDownloadURL)
 }
 
 var ErrInvalidChecksumFile = errors.New("invalid checksum file")
 
-func downloadCheckSum(ctx context.Context, url string) (*Info, error) {
+func downloadCheckSum(ctx context.Context, client *http.Client, url, defaultName string, maxFileSize int64) (*Info, error) {
 	// download the checksum file
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	checksums := make(map[string]string)
-
-	scanner := bufio.NewScanner(resp.Body)
-	// parse the file and return the checksums
-	for scanner.Scan() {
-		line := scanner.Text()
-		// parse the line and extract the checksum
-		line = strings.TrimSpace(line)
-		// there maybe one or more blank spaces between the checksum and the file name
-		parts := strings.Fields(line)
-		// parts[0] is the checksum, parts[1] is the file name
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("%w: checksum file is malformed", ErrInvalidChecksumFile)
-		}
-		checksums[parts[1]] = parts[0]
-	}
-
-	if len(checksums) == 0 {
-		return nil, fmt.Errorf("%w: checksum file is empty", ErrInvalidChecksumFile)
-	}
-	return &Info{Checksums: checksums}, nil
+	return parseChecksumFile(resp.Body, url, defaultName, maxFileSize)
 }
 
 type CheckSumValidator interface {
 	IsCheckSumValid(ctx context.Context, binary string, checksums *Info, downloadedChecksum string) bool
 }
 
-type validator struct {
-	os   string
-	arch string
+// AssetValidator is implemented by validators that can look entries up by the name of the downloaded asset.
+type AssetValidator interface {
+	// IsAssetCheckSumValid reports whether downloadedChecksum matches the entry for asset in checksums.
+	//
+	// Entries are looked up by the asset's name first. If there is no such entry, the validator
+	// falls back to $binary_os_$arch keys.
+	IsAssetCheckSumValid(ctx context.Context, asset release.Asset, binary string, checksums *Info, downloadedChecksum string) bool
+}
+
+// Validator is implemented by validators that can explain why a download failed validation.
+type Validator interface {
+	// Validate returns a *ValidationError if downloadedChecksum doesn't match the entry for asset in checksums.
+	Validate(ctx context.Context, asset release.Asset, binary string, checksums *Info, downloadedChecksum string) error
 }
 
-// String maps arch to string.
-//
-// String maps 386 to i386 and amd64 to x86_64 for consistency across linux and darwin.
+var _ Validator = (*validator)(nil)
+
+type validator struct {
+	platform platform.Platform
+}
 
 type ValidatorOption func(*validator)
 
 func WithOS(os string) ValidatorOption {
 	return func(v *validator) {
-		v.os = os
+		v.platform.OS = platform.New(os, "").OS
 	}
 }
 
-var fallbackArchMap = map[string][]string{
-	"amd64": {"x86_64"},
-	"386":   {"i386", "all"},
-	"arm64": {"all"},
+func WithArch(a string) ValidatorOption {
+	return func(v *validator) {
+		p := platform.New("", a)
+		v.platform.Arch, v.platform.Variant = p.Arch, p.Variant
+	}
 }
 
-func WithArch(a string) ValidatorOption {
+// WithPlatform sets the platform whose checksum entries are validated. It defaults to platform.Current.
+func WithPlatform(p platform.Platform) ValidatorOption {
 	return func(v *validator) {
-		v.arch = strings.ToLower(a)
+		v.platform = p
 	}
 }
 
 func NewCheckSumValidator(opts ...ValidatorOption) CheckSumValidator {
 	v := &validator{
-		os:   runtime.GOOS,
-		arch: strings.ToLower(runtime.GOARCH),
+		platform: platform.Current(),
 	}
 
 	for _, opt := range opts {
@@ -143,27 +161,49 @@ func NewCheckSumValidator(opts ...ValidatorOption) CheckSumValidator {
 }
 
 func (v *validator) IsCheckSumValid(ctx context.Context, binary string, info *Info, downloadedChecksum string) bool {
+	return v.Validate(ctx, release.Asset{}, binary, info, downloadedChecksum) == nil
+}
 
-	key := fmt.Sprintf("%s_%s_%s", binary, v.os, v.arch)
-	expectedChecksum, ok := info.Checksums[key]
-	if !ok {
-		return v.tryFallbackArch(binary, info, downloadedChecksum)
-	}
-	return expectedChecksum == downloadedChecksum
+func (v *validator) IsAssetCheckSumValid(ctx context.Context, asset release.Asset, binary string, info *Info, downloadedChecksum string) bool {
+	return v.Validate(ctx, asset, binary, info, downloadedChecksum) == nil
 }
 
-func (v *validator) tryFallbackArch(binary string, info *Info, downloadedChecksum string) bool {
-	archs, ok := fallbackArchMap[v.arch]
-	if !ok {
-		return false
+func (v *validator) Validate(ctx context.Context, asset release.Asset, binary string, info *Info, downloadedChecksum string) error {
+	// look the entry up by the asset's name first, then try $binary_$os_$arch for every alias of the
+	// platform, in the same order the asset downloader does.
+	var keys []string
+	if name := assetName(asset); name != "" {
+		keys = append(keys, name)
+	}
+	for _, suffix := range v.platform.Suffixes() {
+		keys = append(keys, binary+"_"+suffix)
 	}
 
-	for _, arch := range archs {
-		key := fmt.Sprintf("%s_%s_%s", binary, v.os, arch)
+	for _, key := range keys {
 		expectedChecksum, ok := info.Checksums[key]
-		if ok {
-			return expectedChecksum == downloadedChecksum
+		if !ok {
+			continue
 		}
+		if !digestEqual(expectedChecksum, downloadedChecksum) {
+			return &ValidationError{
+				Err:       ErrChecksumMismatch,
+				Platform:  v.platform,
+				Key:       key,
+				Algorithm: info.Algorithm,
+				Expected:  expectedChecksum,
+				Actual:    downloadedChecksum,
+				Sources:   []string{info.Sources[key]},
+			}
+		}
+		return nil
+	}
+
+	return &ValidationError{
+		Err:       ErrNoChecksumEntry,
+		Platform:  v.platform,
+		KeysTried: keys,
+		Algorithm: info.Algorithm,
+		Actual:    downloadedChecksum,
+		Sources:   info.sourceURLs(),
 	}
-	return false
 }
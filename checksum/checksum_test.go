@@ -9,28 +9,52 @@ import (
 	"testing"
 
 	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/transport"
 	"github.com/stretchr/testify/assert"
 )
 
 // checksumData is a sample checksum file for testing
 // It contains the checksums, one or more spaces and binary_os_arch pairs
 // NOTE: we intentionally have an extra space at the beg of each line
-const checksumData = ` checksum_savvy_darwin_arm64  savvy_darwin_arm64
- checksum_savvy_darwin_x86_64 savvy_darwin_x86_64
- checksum_savvy_linux_arm64 savvy_linux_arm64
- checksum_savvy_linux_i386 savvy_linux_i386
- checksum_savvy_linux_x86_64  savvy_linux_x86_64
+const checksumData = ` 6796a0fb64d0c78b2de5410a94749a3bfb77291747c1835fbd427e8bf00f6af3  savvy_darwin_arm64
+ 3853c410eeee629f71a981844975700b2925ac7582bf5559c384c391be8abbcb savvy_darwin_x86_64
+ 00637eae6cf7588d990d64113a02caca831ea5391ef6f66c88db2dfa576ca6bd savvy_linux_arm64
+ 1e9c98dbb0f54ee06119d957fa140b42780aa330d11208ad0a21c2a06832eca3 savvy_linux_i386
+ 3040ff4c07dda6c7ff65f9476b57277b14a72d0b33381b35aa8810df3e1785ea  savvy_linux_x86_64
+`
+
+// expectedChecksums are the entries in checksumData.
+var expectedChecksums = map[string]string{
+	"savvy_darwin_arm64":  "6796a0fb64d0c78b2de5410a94749a3bfb77291747c1835fbd427e8bf00f6af3",
+	"savvy_darwin_x86_64": "3853c410eeee629f71a981844975700b2925ac7582bf5559c384c391be8abbcb",
+	"savvy_linux_arm64":   "00637eae6cf7588d990d64113a02caca831ea5391ef6f66c88db2dfa576ca6bd",
+	"savvy_linux_i386":    "1e9c98dbb0f54ee06119d957fa140b42780aa330d11208ad0a21c2a06832eca3",
+	"savvy_linux_x86_64":  "3040ff4c07dda6c7ff65f9476b57277b14a72d0b33381b35aa8810df3e1785ea",
+}
+
+const sha512ChecksumData = `CB4F34A7E6E6C1E4C8A0FD1F79B3FCB16A7C1F1B3D2E2A07E2C3A7E8A52D0F7B6C2C2A5B25F0D55EC53BD1B1E2A7D0A5D3B5F4E1B0B4C1D6A9E6A8E0C4B2D1A3  savvy_linux_x86_64
+`
+
+const sha1ChecksumData = `da39a3ee5e6b4b0d3255bfef95601890afd80709  savvy_linux_x86_64
 `
 
 const malformedChecksumData = `6796a0fb64d0c78b2de5410a94749a 3bfb77291747c1835fbd427e8bf00f6af3  savvy_darwin_arm64
 `
 
 func setupTestServer(t *testing.T, handler http.Handler) *httptest.Server {
-	srv := httptest.NewServer(handler)
+	srv := httptest.NewTLSServer(handler)
 	defer t.Cleanup(srv.Close)
 	return srv
 }
 
+// testClient returns a client that enforces the transport policy, allowing only srv.
+func testClient(srv *httptest.Server) *http.Client {
+	return transport.NewClient(
+		transport.WithAllowedHosts("127.0.0.1"),
+		transport.WithBaseTransport(srv.Client().Transport),
+	)
+}
+
 func checkSumDataHandler(t *testing.T) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/octet-stream")
@@ -39,6 +63,14 @@ func checkSumDataHandler(t *testing.T) http.Handler {
 			io.WriteString(w, checksumData)
 			return
 		}
+		if r.URL.Path == "/release_checksums.txt" || r.URL.Path == "/SHA512SUMS" {
+			io.WriteString(w, sha512ChecksumData)
+			return
+		}
+		if r.URL.Path == "/sha1_checksums.txt" {
+			io.WriteString(w, sha1ChecksumData)
+			return
+		}
 		if r.URL.Path == "/empty_checksums.txt" {
 			io.WriteString(w, "")
 			return
@@ -58,19 +90,14 @@ func TestDownloadCheckSum(t *testing.T) {
 	testSuffix := "checksums.txt"
 	t.Run("ValidCheckSumFile", func(t *testing.T) {
 		checksumURL := srv.URL + "/checksums.txt"
-		downloader := NewCheckSumDownloader(WithAssetSuffix(testSuffix))
+		downloader := NewCheckSumDownloader(WithHTTPClient(testClient(srv)), WithAssetSuffix(testSuffix))
 		checksums, err := downloader.Download(ctx, []release.Asset{
 			{BrowserDownloadURL: checksumURL},
 			{BrowserDownloadURL: srv.URL + "/malformed_path.txt"},
 		})
 		assert.NoError(t, err)
 		assert.NotNil(t, checksums)
-		assert.NotEmpty(t, checksums.Checksums)
-		for k, v := range checksums.Checksums {
-			assert.NotEmpty(t, k)
-			assert.NotEmpty(t, v)
-			assert.Equal(t, strings.Join([]string{"checksum", k}, "_"), v)
-		}
+		assert.Equal(t, expectedChecksums, checksums.Checksums)
 	})
 	t.Run("InvalidCheckSumFile", func(t *testing.T) {
 		testCases := []struct {
@@ -88,7 +115,7 @@ func TestDownloadCheckSum(t *testing.T) {
 		}
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
-				downloader := NewCheckSumDownloader(WithAssetSuffix(testSuffix))
+				downloader := NewCheckSumDownloader(WithHTTPClient(testClient(srv)), WithAssetSuffix(testSuffix))
 				checksums, err := downloader.Download(ctx, []release.Asset{
 					{BrowserDownloadURL: tc.url},
 				})
@@ -98,8 +125,50 @@ func TestDownloadCheckSum(t *testing.T) {
 			})
 		}
 	})
+	t.Run("DetectAlgorithm", func(t *testing.T) {
+		testCases := []struct {
+			name      string
+			url       string
+			algorithm Algorithm
+		}{
+			{
+				name:      "DefaultsToSHA256",
+				url:       srv.URL + "/checksums.txt",
+				algorithm: SHA256,
+			},
+			{
+				name:      "FromDigestLength",
+				url:       srv.URL + "/release_checksums.txt",
+				algorithm: SHA512,
+			},
+			{
+				name:      "FromWellKnownFileName",
+				url:       srv.URL + "/SHA512SUMS",
+				algorithm: SHA512,
+			},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				downloader := NewCheckSumDownloader(WithHTTPClient(testClient(srv)), WithAssetSuffix(testSuffix))
+				checksums, err := downloader.Download(ctx, []release.Asset{
+					{BrowserDownloadURL: tc.url},
+				})
+				assert.NoError(t, err)
+				assert.NotNil(t, checksums)
+				assert.Equal(t, tc.algorithm, checksums.Algorithm)
+			})
+		}
+	})
+	t.Run("RefuseWeakAlgorithm", func(t *testing.T) {
+		downloader := NewCheckSumDownloader(WithHTTPClient(testClient(srv)), WithAssetSuffix(testSuffix))
+		checksums, err := downloader.Download(ctx, []release.Asset{
+			{BrowserDownloadURL: srv.URL + "/sha1_checksums.txt"},
+		})
+		assert.ErrorIs(t, err, ErrWeakAlgorithm)
+		assert.Nil(t, checksums)
+	})
 	t.Run("NoCheckSumAsset", func(t *testing.T) {
-		downloader := NewCheckSumDownloader(WithAssetSuffix(testSuffix))
+		downloader := NewCheckSumDownloader(WithHTTPClient(testClient(srv)), WithAssetSuffix(testSuffix))
 		checksums, err := downloader.Download(ctx, []release.Asset{
 			{BrowserDownloadURL: srv.URL + "/savvy_darwin_arm64"},
 		})
@@ -114,9 +183,10 @@ func TestCheckSumValidator(t *testing.T) {
 	const checksum = "checksum"
 	checksumInfo := &Info{
 		Checksums: map[string]string{
-			binary + "_darwin_x86_64": checksum,
-			binary + "_linux_x86_64":  checksum,
-			binary + "_linux_i386":    checksum,
+			binary + "_darwin_x86_64":        checksum,
+			binary + "_linux_x86_64":         checksum,
+			binary + "_linux_i386":           checksum,
+			"savvy_1.2.3_linux_amd64.tar.gz": checksum,
 		},
 	}
 
@@ -127,6 +197,7 @@ func TestCheckSumValidator(t *testing.T) {
 		os                 string
 		arch               string
 		binary             string
+		asset              release.Asset
 	}{
 		{
 			name:               "ValidChecksums",
@@ -152,6 +223,14 @@ func TestCheckSumValidator(t *testing.T) {
 			isValid:            true,
 			binary:             binary,
 		},
+		{
+			name:               "ValidChecksumsIgnoreCase",
+			downloadedChecksum: strings.ToUpper(checksum),
+			os:                 "linux",
+			arch:               "x86_64",
+			isValid:            true,
+			binary:             binary,
+		},
 		{
 			name:               "InvalidChecksums",
 			downloadedChecksum: "invalid_checksum",
@@ -176,6 +255,42 @@ func TestCheckSumValidator(t *testing.T) {
 			isValid:            false,
 			binary:             binary,
 		},
+		{
+			name:               "ValidChecksumsByAssetName",
+			downloadedChecksum: checksum,
+			os:                 "linux",
+			arch:               "amd64",
+			isValid:            true,
+			binary:             "renamed",
+			asset:              release.Asset{Name: "savvy_1.2.3_linux_amd64.tar.gz"},
+		},
+		{
+			name:               "ValidChecksumsByAssetURL",
+			downloadedChecksum: checksum,
+			os:                 "linux",
+			arch:               "amd64",
+			isValid:            true,
+			binary:             "renamed",
+			asset:              release.Asset{BrowserDownloadURL: "https://example.com/savvy_1.2.3_linux_amd64.tar.gz"},
+		},
+		{
+			name:               "InvalidChecksumsByAssetName",
+			downloadedChecksum: "invalid_checksum",
+			os:                 "linux",
+			arch:               "x86_64",
+			isValid:            false,
+			binary:             binary,
+			asset:              release.Asset{Name: "savvy_1.2.3_linux_amd64.tar.gz"},
+		},
+		{
+			name:               "FallbackWhenAssetNameIsMissing",
+			downloadedChecksum: checksum,
+			os:                 "linux",
+			arch:               "x86_64",
+			isValid:            true,
+			binary:             binary,
+			asset:              release.Asset{Name: "savvy-linux-x86_64"},
+		},
 		{
 			name:               "InvalidBinary",
 			downloadedChecksum: checksum,
@@ -189,8 +304,50 @@ func TestCheckSumValidator(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			csv := NewCheckSumValidator(WithArch(tc.arch), WithOS(tc.os))
-			isValid := csv.IsCheckSumValid(context.Background(), tc.binary, checksumInfo, tc.downloadedChecksum)
+			isValid := csv.(AssetValidator).IsAssetCheckSumValid(context.Background(), tc.asset, tc.binary, checksumInfo, tc.downloadedChecksum)
 			assert.Equal(t, tc.isValid, isValid)
+			if assetName(tc.asset) == "" {
+				assert.Equal(t, tc.isValid, csv.IsCheckSumValid(context.Background(), tc.binary, checksumInfo, tc.downloadedChecksum))
+			}
 		})
 	}
 }
+
+func TestValidate(t *testing.T) {
+	const checksumURL = "https://example.com/checksums.txt"
+	info := &Info{
+		Checksums: map[string]string{"savvy_linux_x86_64": linuxDigest},
+		Algorithm: SHA256,
+		Sources:   map[string]string{"savvy_linux_x86_64": checksumURL},
+	}
+	v := NewCheckSumValidator(WithOS("linux"), WithArch("amd64")).(Validator)
+	ctx := context.Background()
+
+	t.Run("Valid", func(t *testing.T) {
+		err := v.Validate(ctx, release.Asset{}, "savvy", info, linuxDigest)
+		assert.NoError(t, err)
+	})
+	t.Run("Mismatch", func(t *testing.T) {
+		err := v.Validate(ctx, release.Asset{}, "savvy", info, darwinDigest)
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+		var verr *ValidationError
+		if assert.ErrorAs(t, err, &verr) {
+			assert.Equal(t, "savvy_linux_x86_64", verr.Key)
+			assert.Equal(t, linuxDigest, verr.Expected)
+			assert.Equal(t, darwinDigest, verr.Actual)
+			assert.Equal(t, []string{checksumURL}, verr.Sources)
+		}
+		assert.ErrorContains(t, err, checksumURL)
+	})
+	t.Run("NoEntry", func(t *testing.T) {
+		err := v.Validate(ctx, release.Asset{Name: "tool_linux_amd64.tar.gz"}, "tool", info, linuxDigest)
+		assert.ErrorIs(t, err, ErrNoChecksumEntry)
+		var verr *ValidationError
+		if assert.ErrorAs(t, err, &verr) {
+			assert.Equal(t, "tool_linux_amd64.tar.gz", verr.KeysTried[0])
+			assert.Contains(t, verr.KeysTried, "tool_linux_x86_64")
+			assert.Equal(t, []string{checksumURL}, verr.Sources)
+		}
+		assert.ErrorContains(t, err, "linux/amd64")
+	})
+}
@@ -0,0 +1,72 @@
+package checksum
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/platform"
+)
+
+var (
+	// ErrNoChecksumEntry means the checksum files have no entry for the downloaded asset.
+	ErrNoChecksumEntry = errors.New("no checksum entry")
+	// ErrChecksumMismatch means the digest of the downloaded asset doesn't match its checksum entry.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// ValidationError explains why a download failed validation.
+//
+// Err is either ErrNoChecksumEntry or ErrChecksumMismatch.
+type ValidationError struct {
+	Err      error
+	Platform platform.Platform
+	// KeysTried lists the entries that were looked up, in order. It is only set for ErrNoChecksumEntry.
+	KeysTried []string
+	// Key is the entry that was found. It is only set for ErrChecksumMismatch.
+	Key       string
+	Algorithm Algorithm
+	Expected  string
+	Actual    string
+	// Sources holds the URLs of the checksum files that were consulted.
+	Sources []string
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Err.Error())
+	if e.Key != "" {
+		fmt.Fprintf(&b, " for %s", e.Key)
+	} else {
+		fmt.Fprintf(&b, " for %s", e.Platform)
+	}
+	if len(e.Sources) > 0 {
+		fmt.Fprintf(&b, " in %s", strings.Join(e.Sources, ", "))
+	}
+	if len(e.KeysTried) > 0 {
+		fmt.Fprintf(&b, ": tried %s", strings.Join(e.KeysTried, ", "))
+	}
+	if e.Expected != "" {
+		fmt.Fprintf(&b, ": expected %s %s, got %s", e.Algorithm, e.Expected, e.Actual)
+	}
+	return b.String()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// sourceURLs returns the distinct URLs of the checksum files i was built from.
+func (i *Info) sourceURLs() []string {
+	seen := make(map[string]bool)
+	var urls []string
+	for _, url := range i.Sources {
+		if url != "" && !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
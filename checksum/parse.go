@@ -0,0 +1,199 @@
+package checksum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// DefaultMaxFileSize is the largest checksum file that will be parsed.
+const DefaultMaxFileSize int64 = 1 << 20
+
+var ErrChecksumFileTooLarge = errors.New("checksum file too large")
+
+// bsdLine matches the tagged format produced by `sha256sum --tag` and BSD `sha256`:
+//
+//	SHA256 (savvy_linux_x86_64) = 3040ff4c07dda6c7ff65f9476b57277b14a72d0b33381b35aa8810df3e1785ea
+var bsdLine = regexp.MustCompile(`^([A-Za-z0-9-]+) ?\((.*)\) ?= ?([0-9A-Fa-f]+)$`)
+
+var bsdAlgorithms = map[string]Algorithm{
+	"SHA256":   SHA256,
+	"SHA2-256": SHA256,
+	"SHA512":   SHA512,
+	"SHA2-512": SHA512,
+	"BLAKE3":   BLAKE3,
+	"SHA1":     SHA1,
+	"MD5":      MD5,
+}
+
+// parseChecksumFile parses a checksum file named filename.
+//
+// It understands:
+//   - coreutils output, in text (`hash  file`) and binary (`hash *file`) mode
+//   - coreutils escaped file names (lines starting with a backslash)
+//   - BSD tagged output (`SHA256 (file) = hash`)
+//   - file names containing spaces
+//   - blank lines and lines starting with #
+//
+// Lines containing only a digest, as found in sidecar files, are attributed to
+// defaultName. They are rejected if defaultName is empty.
+//
+// Files larger than maxSize are rejected with ErrChecksumFileTooLarge.
+func parseChecksumFile(r io.Reader, filename, defaultName string, maxSize int64) (*Info, error) {
+	// read one byte past the limit so that we can tell a file of exactly maxSize from a larger one.
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrChecksumFileTooLarge, maxSize)
+	}
+
+	checksums := make(map[string]string)
+	// names and lines keep track of where each entry came from for error messages.
+	var names []string
+	lines := make(map[string]int)
+	var tagged Algorithm
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 4096), len(data)+1)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, digest, algorithm, err := parseLine(line, defaultName)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidChecksumFile, lineNumber, err)
+		}
+
+		if algorithm != "" {
+			if tagged != "" && tagged != algorithm {
+				return nil, fmt.Errorf("%w: line %d: mixed algorithms %s and %s", ErrInvalidChecksumFile, lineNumber, tagged, algorithm)
+			}
+			tagged = algorithm
+		}
+
+		if existing, ok := checksums[name]; ok && !digestEqual(existing, digest) {
+			return nil, fmt.Errorf("%w: line %d: conflicting checksums for %s", ErrInvalidChecksumFile, lineNumber, name)
+		}
+		if _, ok := checksums[name]; !ok {
+			names = append(names, name)
+			lines[name] = lineNumber
+		}
+		checksums[name] = digest
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(checksums) == 0 {
+		return nil, fmt.Errorf("%w: checksum file is empty", ErrInvalidChecksumFile)
+	}
+
+	algorithm := tagged
+	if algorithm == "" {
+		var err error
+		if algorithm, err = detectAlgorithm(filename, checksums[names[0]]); err != nil {
+			return nil, err
+		}
+	} else if algorithm.IsWeak() {
+		return nil, fmt.Errorf("%w: %s", ErrWeakAlgorithm, algorithm)
+	}
+
+	// every digest must have the length produced by algorithm.
+	want := hex.EncodedLen(digestSize(algorithm))
+	for _, name := range names {
+		if digest := checksums[name]; len(digest) != want {
+			return nil, fmt.Errorf("%w: line %d: %s checksum for %s has length %d, expected %d", ErrInvalidChecksumFile, lines[name], algorithm, name, len(digest), want)
+		}
+	}
+	sources := make(map[string]string, len(checksums))
+	for name := range checksums {
+		sources[name] = filename
+	}
+	return &Info{Checksums: checksums, Algorithm: algorithm, Sources: sources}, nil
+}
+
+// parseLine parses a single non-blank, non-comment line.
+//
+// algorithm is only set for BSD tagged lines.
+func parseLine(line, defaultName string) (name, digest string, algorithm Algorithm, err error) {
+	if m := bsdLine.FindStringSubmatch(line); m != nil {
+		tag, ok := bsdAlgorithms[strings.ToUpper(m[1])]
+		if !ok {
+			return "", "", "", fmt.Errorf("unknown algorithm %q", m[1])
+		}
+		if m[2] == "" {
+			return "", "", "", errors.New("missing file name")
+		}
+		return m[2], m[3], tag, nil
+	}
+
+	// coreutils prefixes the line with a backslash when the file name contains a backslash or newline.
+	escaped := strings.HasPrefix(line, `\`)
+	if escaped {
+		line = line[1:]
+	}
+
+	// there may be one or more blank spaces between the checksum and the file name,
+	// and the file name itself may contain spaces.
+	i := strings.IndexAny(line, " \t")
+	if i < 0 && defaultName != "" && !escaped {
+		line, i = line+" "+defaultName, len(line)
+	}
+	if i < 0 {
+		return "", "", "", errors.New("expected a checksum followed by a file name")
+	}
+	digest, name = line[:i], strings.TrimLeft(line[i:], " \t")
+	// `sha256sum -b` marks binary mode with a leading * on the file name.
+	name = strings.TrimPrefix(name, "*")
+	if escaped {
+		name = unescapeName(name)
+	}
+	if name == "" {
+		return "", "", "", errors.New("missing file name")
+	}
+	if !isHex(digest) {
+		return "", "", "", fmt.Errorf("checksum %q is not hex encoded", digest)
+	}
+	return name, digest, "", nil
+}
+
+// unescapeName reverses the escaping coreutils applies to file names.
+func unescapeName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+1 < len(name) {
+			switch name[i+1] {
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+func isHex(s string) bool {
+	if s == "" || len(s)%2 != 0 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,195 @@
+package checksum
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	linuxDigest  = "3040ff4c07dda6c7ff65f9476b57277b14a72d0b33381b35aa8810df3e1785ea"
+	darwinDigest = "6796a0fb64d0c78b2de5410a94749a3bfb77291747c1835fbd427e8bf00f6af3"
+)
+
+func TestParseChecksumFile(t *testing.T) {
+	testCases := []struct {
+		name      string
+		data      string
+		checksums map[string]string
+		algorithm Algorithm
+	}{
+		{
+			name:      "TextMode",
+			data:      linuxDigest + "  savvy_linux_x86_64\n",
+			checksums: map[string]string{"savvy_linux_x86_64": linuxDigest},
+			algorithm: SHA256,
+		},
+		{
+			name:      "BinaryMode",
+			data:      linuxDigest + " *savvy_linux_x86_64\n",
+			checksums: map[string]string{"savvy_linux_x86_64": linuxDigest},
+			algorithm: SHA256,
+		},
+		{
+			name:      "TabSeparated",
+			data:      linuxDigest + "\tsavvy_linux_x86_64\n",
+			checksums: map[string]string{"savvy_linux_x86_64": linuxDigest},
+			algorithm: SHA256,
+		},
+		{
+			name:      "FileNameWithSpaces",
+			data:      linuxDigest + "  savvy for linux\n",
+			checksums: map[string]string{"savvy for linux": linuxDigest},
+			algorithm: SHA256,
+		},
+		{
+			name:      "EscapedFileName",
+			data:      `\` + linuxDigest + `  savvy\\linux\nx86_64` + "\n",
+			checksums: map[string]string{"savvy\\linux\nx86_64": linuxDigest},
+			algorithm: SHA256,
+		},
+		{
+			name: "CommentsAndBlankLines",
+			data: "# generated by goreleaser\n\n" + linuxDigest + "  savvy_linux_x86_64\n\n" +
+				"   # indented comment\n" + darwinDigest + "  savvy_darwin_arm64",
+			checksums: map[string]string{
+				"savvy_linux_x86_64": linuxDigest,
+				"savvy_darwin_arm64": darwinDigest,
+			},
+			algorithm: SHA256,
+		},
+		{
+			name: "BSDTagged",
+			data: "SHA256 (savvy_linux_x86_64) = " + linuxDigest + "\n" +
+				"SHA256 (savvy darwin (arm64)) = " + darwinDigest + "\n",
+			checksums: map[string]string{
+				"savvy_linux_x86_64":   linuxDigest,
+				"savvy darwin (arm64)": darwinDigest,
+			},
+			algorithm: SHA256,
+		},
+		{
+			name:      "BSDTaggedBlake3",
+			data:      "BLAKE3 (savvy_linux_x86_64) = " + linuxDigest + "\n",
+			checksums: map[string]string{"savvy_linux_x86_64": linuxDigest},
+			algorithm: BLAKE3,
+		},
+		{
+			name:      "DuplicateEntries",
+			data:      linuxDigest + "  savvy_linux_x86_64\n" + strings.ToUpper(linuxDigest) + " *savvy_linux_x86_64\n",
+			checksums: map[string]string{"savvy_linux_x86_64": strings.ToUpper(linuxDigest)},
+			algorithm: SHA256,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := parseChecksumFile(strings.NewReader(tc.data), "checksums.txt", "", DefaultMaxFileSize)
+			assert.NoError(t, err)
+			if assert.NotNil(t, info) {
+				assert.Equal(t, tc.checksums, info.Checksums)
+				assert.Equal(t, tc.algorithm, info.Algorithm)
+			}
+		})
+	}
+}
+
+func TestParseChecksumFileErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    string
+		maxSize int64
+		err     error
+		message string
+	}{
+		{
+			name:    "MissingFileName",
+			data:    "# header\n" + linuxDigest + "\n",
+			err:     ErrInvalidChecksumFile,
+			message: "line 2",
+		},
+		{
+			name:    "NotHex",
+			data:    linuxDigest + "  savvy_linux_x86_64\nnot-a-checksum  savvy_darwin_arm64\n",
+			err:     ErrInvalidChecksumFile,
+			message: "line 2",
+		},
+		{
+			name:    "WrongLength",
+			data:    linuxDigest + "  savvy_linux_x86_64\n\n" + linuxDigest[:62] + "  savvy_darwin_arm64\n",
+			err:     ErrInvalidChecksumFile,
+			message: "line 3",
+		},
+		{
+			name:    "ConflictingEntries",
+			data:    linuxDigest + "  savvy_linux_x86_64\n" + darwinDigest + "  savvy_linux_x86_64\n",
+			err:     ErrInvalidChecksumFile,
+			message: "line 2",
+		},
+		{
+			name:    "MixedBSDAlgorithms",
+			data:    "SHA256 (a) = " + linuxDigest + "\nBLAKE3 (b) = " + darwinDigest + "\n",
+			err:     ErrInvalidChecksumFile,
+			message: "line 2",
+		},
+		{
+			name:    "UnknownBSDAlgorithm",
+			data:    "CRC32 (a) = cbf43926\n",
+			err:     ErrInvalidChecksumFile,
+			message: "line 1",
+		},
+		{
+			name: "WeakBSDAlgorithm",
+			data: "MD5 (a) = d41d8cd98f00b204e9800998ecf8427e\n",
+			err:  ErrWeakAlgorithm,
+		},
+		{
+			name: "OnlyComments",
+			data: "# nothing to see here\n\n",
+			err:  ErrInvalidChecksumFile,
+		},
+		{
+			name:    "TooLarge",
+			data:    linuxDigest + "  savvy_linux_x86_64\n",
+			maxSize: 32,
+			err:     ErrChecksumFileTooLarge,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			maxSize := tc.maxSize
+			if maxSize == 0 {
+				maxSize = DefaultMaxFileSize
+			}
+			info, err := parseChecksumFile(strings.NewReader(tc.data), "checksums.txt", "", maxSize)
+			assert.ErrorIs(t, err, tc.err)
+			assert.Nil(t, info)
+			if tc.message != "" {
+				assert.ErrorContains(t, err, tc.message)
+			}
+		})
+	}
+}
+
+func FuzzParseChecksumFile(f *testing.F) {
+	f.Add(checksumData)
+	f.Add(malformedChecksumData)
+	f.Add(sha512ChecksumData)
+	f.Add("SHA256 (savvy_linux_x86_64) = " + linuxDigest + "\n")
+	f.Add(`\` + linuxDigest + ` *savvy\\linux` + "\n# comment\n")
+	f.Fuzz(func(t *testing.T, data string) {
+		info, err := parseChecksumFile(strings.NewReader(data), "checksums.txt", "", DefaultMaxFileSize)
+		if err != nil {
+			assert.Nil(t, info)
+			return
+		}
+		assert.NotEmpty(t, info.Checksums)
+		assert.Contains(t, SupportedAlgorithms, info.Algorithm)
+		for name, digest := range info.Checksums {
+			assert.NotEmpty(t, name)
+			assert.True(t, isHex(digest), "digest %q for %q is not hex", digest, name)
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package checksum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// Resolver resolves the checksums for a specific release asset.
+type Resolver interface {
+	Resolve(ctx context.Context, target release.Asset, assets []release.Asset) (*Info, error)
+}
+
+var _ Resolver = (*checksumDownloader)(nil)
+
+// Strategy controls which checksum files are consulted for an asset.
+type Strategy int
+
+const (
+	// PreferSidecar uses a sidecar file for the asset (e.g savvy_linux_x86_64.sha256) when one
+	// exists and falls back to the aggregate checksum files otherwise.
+	PreferSidecar Strategy = iota
+	// AggregateOnly ignores sidecar files.
+	AggregateOnly
+	// SidecarOnly requires a sidecar file for the asset.
+	SidecarOnly
+)
+
+// sidecarExtensions are the extensions of per-asset checksum files and the algorithm they hold.
+var sidecarExtensions = []struct {
+	ext       string
+	algorithm Algorithm
+}{
+	{".sha512", SHA512},
+	{".sha512sum", SHA512},
+	{".sha256", SHA256},
+	{".sha256sum", SHA256},
+	{".b3", BLAKE3},
+	{".blake3", BLAKE3},
+}
+
+// algorithmPreference orders algorithms from most to least preferred when several
+// checksum files cover the same asset.
+var algorithmPreference = []Algorithm{SHA512, BLAKE3, SHA256}
+
+var ErrConflictingChecksums = errors.New("conflicting checksums")
+
+// Resolve downloads the checksums for target.
+//
+// Depending on the Strategy, a sidecar file for target is preferred. Otherwise every aggregate
+// checksum file in assets is downloaded and merged. Aggregate files using a weak algorithm, or that
+// can't be parsed, are skipped, unless there is no other checksum file. Entries that appear in several files with
+// different digests are reported as ErrConflictingChecksums, including a sidecar whose digest
+// differs from an aggregate file using the same algorithm.
+//
+// If the aggregate files use different algorithms, the strongest one that has an entry for
+// target is returned.
+func (c *checksumDownloader) Resolve(ctx context.Context, target release.Asset, assets []release.Asset) (*Info, error) {
+	targetName := assetName(target)
+	if targetName != "" && c.strategy != AggregateOnly {
+		if sidecar, algorithm, ok := sidecarFor(targetName, assets); ok {
+			info, err := c.downloadSidecar(ctx, targetName, sidecar, algorithm)
+			if err != nil {
+				return nil, err
+			}
+			// aggregates that can't be used, e.g MD5SUMS next to SHA256SUMS, don't matter since there is a sidecar.
+			merged, _, err := c.downloadAggregates(ctx, assets)
+			if err != nil {
+				return nil, err
+			}
+			if aggregate, ok := merged[info.Algorithm]; ok {
+				if err := info.merge(aggregate.only(targetName)); err != nil {
+					return nil, fmt.Errorf("%w in %s", err, aggregate.Sources[targetName])
+				}
+			}
+			return info, nil
+		}
+		if c.strategy == SidecarOnly {
+			return nil, fmt.Errorf("%w: no sidecar for %s", ErrNoCheckSumAsset, targetName)
+		}
+	}
+
+	merged, skipped, err := c.downloadAggregates(ctx, assets)
+	if err != nil {
+		return nil, err
+	}
+	if len(merged) == 0 {
+		if skipped != nil {
+			return nil, skipped
+		}
+		return nil, ErrNoCheckSumAsset
+	}
+
+	for _, algorithm := range algorithmPreference {
+		if info, ok := merged[algorithm]; ok && info.Checksums[targetName] != "" {
+			return info, nil
+		}
+	}
+	for _, algorithm := range algorithmPreference {
+		if info, ok := merged[algorithm]; ok {
+			return info, nil
+		}
+	}
+	return nil, ErrNoCheckSumAsset
+}
+
+// downloadAggregates downloads every aggregate checksum file in assets, and merges the files that use the same algorithm.
+//
+// Files that can't be used are skipped, and the reasons they were skipped are returned as skipped.
+func (c *checksumDownloader) downloadAggregates(ctx context.Context, assets []release.Asset) (merged map[Algorithm]*Info, skipped error, err error) {
+	merged = make(map[Algorithm]*Info)
+	var unusable []error
+	for _, asset := range assets {
+		if !c.isAggregate(asset) {
+			continue
+		}
+		info, err := downloadCheckSum(ctx, c.client, asset.BrowserDownloadURL, "", c.maxFileSize)
+		if isUnusable(err) {
+			unusable = append(unusable, fmt.Errorf("%s: %w", asset.BrowserDownloadURL, err))
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		existing, ok := merged[info.Algorithm]
+		if !ok {
+			merged[info.Algorithm] = info
+			continue
+		}
+		if err := existing.merge(info); err != nil {
+			return nil, nil, fmt.Errorf("%w in %s", err, asset.BrowserDownloadURL)
+		}
+	}
+	return merged, errors.Join(unusable...), nil
+}
+
+// isUnusable reports whether err means a checksum file can't be used to validate a download, e.g
+// because it holds MD5 checksums, rather than that it couldn't be downloaded.
+func isUnusable(err error) bool {
+	return errors.Is(err, ErrWeakAlgorithm) || errors.Is(err, ErrUnsupportedAlgorithm) || errors.Is(err, ErrInvalidChecksumFile)
+}
+
+func (c *checksumDownloader) downloadSidecar(ctx context.Context, targetName string, sidecar release.Asset, algorithm Algorithm) (*Info, error) {
+	info, err := downloadCheckSum(ctx, c.client, sidecar.BrowserDownloadURL, targetName, c.maxFileSize)
+	if err != nil {
+		return nil, err
+	}
+	if info.Algorithm != algorithm {
+		return nil, fmt.Errorf("%w: %s contains %s checksums", ErrInvalidChecksumFile, sidecar.BrowserDownloadURL, info.Algorithm)
+	}
+
+	// sidecars frequently list the file under a different name, e.g. the name of the binary before it was uploaded.
+	if _, ok := info.Checksums[targetName]; !ok {
+		if len(info.Checksums) != 1 {
+			return nil, fmt.Errorf("%w: %s has no entry for %s", ErrInvalidChecksumFile, sidecar.BrowserDownloadURL, targetName)
+		}
+		for name, digest := range info.Checksums {
+			info.Checksums[targetName] = digest
+			info.Sources[targetName] = info.Sources[name]
+		}
+	}
+	return info, nil
+}
+
+// merge adds the entries of other to i.
+func (i *Info) merge(other *Info) error {
+	for name, digest := range other.Checksums {
+		if existing, ok := i.Checksums[name]; ok && !digestEqual(existing, digest) {
+			return fmt.Errorf("%w: %s has digests %s and %s", ErrConflictingChecksums, name, existing, digest)
+		}
+		if _, ok := i.Checksums[name]; ok {
+			continue
+		}
+		i.Checksums[name] = digest
+		if i.Sources == nil {
+			i.Sources = make(map[string]string)
+		}
+		i.Sources[name] = other.Sources[name]
+	}
+	return nil
+}
+
+// only returns the entry of i for name, if there is one.
+func (i *Info) only(name string) *Info {
+	only := &Info{Checksums: map[string]string{}, Sources: map[string]string{}, Algorithm: i.Algorithm}
+	if digest, ok := i.Checksums[name]; ok {
+		only.Checksums[name] = digest
+		only.Sources[name] = i.Sources[name]
+	}
+	return only
+}
+
+// sidecarFor finds the sidecar checksum file for the asset named name.
+func sidecarFor(name string, assets []release.Asset) (release.Asset, Algorithm, bool) {
+	for _, sidecar := range sidecarExtensions {
+		for _, asset := range assets {
+			if assetName(asset) == name+sidecar.ext {
+				return asset, sidecar.algorithm, true
+			}
+		}
+	}
+	return release.Asset{}, "", false
+}
+
+// assetName returns the file name of asset, falling back to the last element of its download URL.
+func assetName(asset release.Asset) string {
+	if asset.Name != "" {
+		return asset.Name
+	}
+	if asset.BrowserDownloadURL == "" {
+		return ""
+	}
+	return path.Base(asset.BrowserDownloadURL)
+}
@@ -0,0 +1,160 @@
+package checksum
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+)
+
+const blake3Digest = "1e9c98dbb0f54ee06119d957fa140b42780aa330d11208ad0a21c2a06832eca3"
+
+// resolverFiles are served by resolverHandler, keyed on path.
+var resolverFiles = map[string]string{
+	"/savvy_linux_x86_64.sha256": linuxDigest + "\n",
+	"/savvy_linux_x86_64.b3":     blake3Digest + "  savvy\n",
+	"/linux_checksums.txt":       linuxDigest + "  savvy_linux_x86_64\n",
+	"/darwin_checksums.txt":      darwinDigest + "  savvy_darwin_arm64\n",
+	"/conflicting_checksums.txt": darwinDigest + "  savvy_linux_x86_64\n",
+	"/sha512sums.txt":            sha512ChecksumData,
+	"/SHA256SUMS":                linuxDigest + "  savvy_linux_x86_64\n",
+	"/MD5SUMS":                   "0cc175b9c0f1b6a831c399e269772661  savvy_linux_x86_64\n",
+}
+
+func resolverHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := resolverFiles[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected URL: %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, data)
+	})
+}
+
+func TestResolve(t *testing.T) {
+	srv := setupTestServer(t, resolverHandler(t))
+	ctx := context.Background()
+	asset := func(name string) release.Asset {
+		return release.Asset{Name: name, BrowserDownloadURL: srv.URL + "/" + name}
+	}
+	target := asset("savvy_linux_x86_64")
+
+	t.Run("PreferSidecar", func(t *testing.T) {
+		resolver := NewCheckSumDownloader(WithHTTPClient(testClient(srv))).(Resolver)
+		info, err := resolver.Resolve(ctx, target, []release.Asset{
+			target,
+			asset("linux_checksums.txt"),
+			asset("savvy_linux_x86_64.sha256"),
+		})
+		assert.NoError(t, err)
+		if assert.NotNil(t, info) {
+			assert.Equal(t, SHA256, info.Algorithm)
+			assert.Equal(t, linuxDigest, info.Checksums[target.Name])
+		}
+	})
+	t.Run("SidecarWithDifferentName", func(t *testing.T) {
+		resolver := NewCheckSumDownloader(WithHTTPClient(testClient(srv))).(Resolver)
+		info, err := resolver.Resolve(ctx, target, []release.Asset{
+			target,
+			asset("savvy_linux_x86_64.b3"),
+		})
+		assert.NoError(t, err)
+		if assert.NotNil(t, info) {
+			assert.Equal(t, BLAKE3, info.Algorithm)
+			assert.Equal(t, blake3Digest, info.Checksums[target.Name])
+		}
+	})
+	t.Run("MergeAggregates", func(t *testing.T) {
+		resolver := NewCheckSumDownloader(WithHTTPClient(testClient(srv))).(Resolver)
+		info, err := resolver.Resolve(ctx, target, []release.Asset{
+			target,
+			asset("linux_checksums.txt"),
+			asset("darwin_checksums.txt"),
+		})
+		assert.NoError(t, err)
+		if assert.NotNil(t, info) {
+			assert.Equal(t, map[string]string{
+				"savvy_linux_x86_64": linuxDigest,
+				"savvy_darwin_arm64": darwinDigest,
+			}, info.Checksums)
+		}
+	})
+	t.Run("AggregateOnly", func(t *testing.T) {
+		resolver := NewCheckSumDownloader(WithHTTPClient(testClient(srv)), WithStrategy(AggregateOnly)).(Resolver)
+		info, err := resolver.Resolve(ctx, target, []release.Asset{
+			target,
+			asset("savvy_linux_x86_64.b3"),
+			asset("linux_checksums.txt"),
+		})
+		assert.NoError(t, err)
+		if assert.NotNil(t, info) {
+			assert.Equal(t, SHA256, info.Algorithm)
+			assert.Equal(t, linuxDigest, info.Checksums[target.Name])
+		}
+	})
+	t.Run("PreferStrongestAlgorithmWithEntry", func(t *testing.T) {
+		resolver := NewCheckSumDownloader(WithHTTPClient(testClient(srv))).(Resolver)
+		info, err := resolver.Resolve(ctx, target, []release.Asset{
+			target,
+			asset("linux_checksums.txt"),
+			asset("sha512sums.txt"),
+		})
+		assert.NoError(t, err)
+		if assert.NotNil(t, info) {
+			assert.Equal(t, SHA512, info.Algorithm)
+		}
+	})
+	t.Run("ConflictingChecksums", func(t *testing.T) {
+		resolver := NewCheckSumDownloader(WithHTTPClient(testClient(srv))).(Resolver)
+		info, err := resolver.Resolve(ctx, target, []release.Asset{
+			target,
+			asset("linux_checksums.txt"),
+			asset("conflicting_checksums.txt"),
+		})
+		assert.ErrorIs(t, err, ErrConflictingChecksums)
+		assert.Nil(t, info)
+	})
+	t.Run("SidecarConflictsWithAggregate", func(t *testing.T) {
+		resolver := NewCheckSumDownloader(WithHTTPClient(testClient(srv))).(Resolver)
+		info, err := resolver.Resolve(ctx, target, []release.Asset{
+			target,
+			asset("conflicting_checksums.txt"),
+			asset("savvy_linux_x86_64.sha256"),
+		})
+		assert.ErrorIs(t, err, ErrConflictingChecksums)
+		assert.Nil(t, info)
+	})
+	t.Run("SkipWeakAggregates", func(t *testing.T) {
+		resolver := NewCheckSumDownloader(WithHTTPClient(testClient(srv))).(Resolver)
+		for _, assets := range [][]release.Asset{
+			{target, asset("SHA256SUMS"), asset("MD5SUMS")},
+			{target, asset("MD5SUMS"), asset("savvy_linux_x86_64.sha256")},
+		} {
+			info, err := resolver.Resolve(ctx, target, assets)
+			assert.NoError(t, err)
+			if assert.NotNil(t, info) {
+				assert.Equal(t, SHA256, info.Algorithm)
+				assert.Equal(t, linuxDigest, info.Checksums[target.Name])
+			}
+		}
+
+		// the release has no checksums that can be used.
+		info, err := resolver.Resolve(ctx, target, []release.Asset{target, asset("MD5SUMS")})
+		assert.ErrorIs(t, err, ErrWeakAlgorithm)
+		assert.Nil(t, info)
+	})
+	t.Run("SidecarOnlyWithoutSidecar", func(t *testing.T) {
+		resolver := NewCheckSumDownloader(WithHTTPClient(testClient(srv)), WithStrategy(SidecarOnly)).(Resolver)
+		info, err := resolver.Resolve(ctx, target, []release.Asset{
+			target,
+			asset("linux_checksums.txt"),
+		})
+		assert.ErrorIs(t, err, ErrNoCheckSumAsset)
+		assert.Nil(t, info)
+	})
+}
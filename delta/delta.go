@@ -0,0 +1,121 @@
+// Package delta creates and applies binary patches, so that upgrades only download what changed.
+//
+// Patches are produced with the bsdiff algorithm. A patch is a header holding the size of the new
+// file, followed by a gzip stream of records. Each record adds a diff to a range of the old file,
+// appends extra bytes that aren't in the old file, then seeks in the old file.
+//
+// The format, identified by the magic UCDELTA1, is specific to this package. It isn't the BSDIFF40
+// format, so bsdiff and bspatch can't read or produce these patches: generate them with Diff, DiffFile
+// or GenerateRelease.
+package delta
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrCorruptPatch means a patch is malformed, or was made for another old file.
+	ErrCorruptPatch = errors.New("corrupt patch")
+	// ErrPatchTooLarge means a patch produces a file larger than MaxSize.
+	ErrPatchTooLarge = errors.New("patched file too large")
+)
+
+// MaxSize is the largest file a patch may produce, which guards against malicious patches.
+const MaxSize int64 = 1 << 30
+
+// magic identifies the patch format.
+const magic = "UCDELTA1"
+
+// header is the fixed size start of a patch.
+type header struct {
+	Magic   [8]byte
+	NewSize int64
+}
+
+// control is the start of a record.
+type control struct {
+	// Diff is the number of bytes added to the old file.
+	Diff int64
+	// Extra is the number of bytes copied from the patch.
+	Extra int64
+	// Seek is how far to move in the old file after the diff.
+	Seek int64
+}
+
+// Patch applies patch to old, writing the new file to w.
+//
+// It returns an error wrapping ErrCorruptPatch if the patch is malformed or refers to data outside
+// of old. Patches don't identify the file they were made for, so the output must be validated, e.g
+// against the release's checksums.
+func Patch(old io.ReaderAt, patch io.Reader, w io.Writer) error {
+	var h header
+	if err := binary.Read(patch, binary.BigEndian, &h); err != nil {
+		return fmt.Errorf("%w: %w", ErrCorruptPatch, err)
+	}
+	if string(h.Magic[:]) != magic || h.NewSize < 0 {
+		return fmt.Errorf("%w: unknown format", ErrCorruptPatch)
+	}
+	if h.NewSize > MaxSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrPatchTooLarge, h.NewSize, MaxSize)
+	}
+
+	zr, err := gzip.NewReader(patch)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCorruptPatch, err)
+	}
+	defer zr.Close()
+	r := bufio.NewReader(zr)
+
+	diff := make([]byte, 32*1024)
+	oldBuf := make([]byte, len(diff))
+	var oldPos, newPos int64
+	for newPos < h.NewSize {
+		var c control
+		if err := binary.Read(r, binary.BigEndian, &c); err != nil {
+			return fmt.Errorf("%w: %w", ErrCorruptPatch, err)
+		}
+		if c.Diff < 0 || c.Extra < 0 || c.Diff > h.NewSize-newPos || c.Extra > h.NewSize-newPos-c.Diff {
+			return fmt.Errorf("%w: record exceeds the patched file", ErrCorruptPatch)
+		}
+
+		for n := c.Diff; n > 0; {
+			chunk := min(n, int64(len(diff)))
+			if _, err := io.ReadFull(r, diff[:chunk]); err != nil {
+				return fmt.Errorf("%w: %w", ErrCorruptPatch, err)
+			}
+			if oldPos < 0 {
+				return fmt.Errorf("%w: negative offset in old file", ErrCorruptPatch)
+			}
+			if _, err := old.ReadAt(oldBuf[:chunk], oldPos); err != nil {
+				return fmt.Errorf("%w: reading old file at %d: %w", ErrCorruptPatch, oldPos, err)
+			}
+			for i := range diff[:chunk] {
+				diff[i] += oldBuf[i]
+			}
+			if _, err := w.Write(diff[:chunk]); err != nil {
+				return err
+			}
+			n -= chunk
+			oldPos += chunk
+		}
+
+		if _, err := io.CopyN(w, r, c.Extra); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("%w: %w", ErrCorruptPatch, io.ErrUnexpectedEOF)
+			}
+			return err
+		}
+		newPos += c.Diff + c.Extra
+		oldPos += c.Seek
+	}
+
+	if _, err := r.ReadByte(); err != io.EOF {
+		return fmt.Errorf("%w: trailing data", ErrCorruptPatch)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// roundTrip diffs old and new, and returns the patch and the result of applying it to old.
+func roundTrip(t *testing.T, old, new []byte) ([]byte, []byte) {
+	t.Helper()
+	var patch, out bytes.Buffer
+	assert.NoError(t, Diff(old, new, &patch))
+	assert.NoError(t, Patch(bytes.NewReader(old), bytes.NewReader(patch.Bytes()), &out))
+	return patch.Bytes(), out.Bytes()
+}
+
+func TestDiffAndPatch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rng.Read(b)
+		return b
+	}
+	old := random(256 * 1024)
+	// a new version changes a few bytes, inserts and removes some code and appends a section.
+	modified := append([]byte{}, old[:1000]...)
+	modified = append(modified, random(500)...)
+	modified = append(modified, old[5000:100000]...)
+	for i := 0; i < 200; i++ {
+		modified[rng.Intn(len(modified))]++
+	}
+	modified = append(modified, old[150000:]...)
+	modified = append(modified, random(2000)...)
+
+	tests := []struct {
+		name     string
+		old, new []byte
+	}{
+		{name: "Modified", old: old, new: modified},
+		{name: "Identical", old: old, new: old},
+		{name: "EmptyOld", old: nil, new: random(1000)},
+		{name: "EmptyNew", old: old, new: nil},
+		{name: "Unrelated", old: random(4096), new: random(4096)},
+		{name: "Repetitive", old: bytes.Repeat([]byte("abc"), 10000), new: bytes.Repeat([]byte("abcd"), 10000)},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, out := roundTrip(t, tc.old, tc.new)
+			assert.True(t, bytes.Equal(tc.new, out))
+		})
+	}
+
+	t.Run("Small", func(t *testing.T) {
+		patch, _ := roundTrip(t, old, modified)
+		assert.Less(t, len(patch), len(modified)/10)
+	})
+}
+
+func TestPatchCorrupt(t *testing.T) {
+	old := bytes.Repeat([]byte("savvy"), 1000)
+	new := append(append([]byte{}, old[:3000]...), []byte("new code")...)
+	var patch bytes.Buffer
+	assert.NoError(t, Diff(old, new, &patch))
+
+	tests := []struct {
+		name  string
+		old   []byte
+		patch []byte
+	}{
+		{name: "Empty", old: old, patch: nil},
+		{name: "NotAPatch", old: old, patch: []byte("#!/bin/sh\necho savvy\n")},
+		{name: "Truncated", old: old, patch: patch.Bytes()[:patch.Len()-10]},
+		{name: "WrongOld", old: old[:100], patch: patch.Bytes()},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := Patch(bytes.NewReader(tc.old), bytes.NewReader(tc.patch), &bytes.Buffer{})
+			assert.ErrorIs(t, err, ErrCorruptPatch)
+		})
+	}
+}
+
+func TestGenerateRelease(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "savvy_1.2.3")
+	newPath := filepath.Join(dir, "savvy_1.3.0")
+	assert.NoError(t, os.WriteFile(oldPath, bytes.Repeat([]byte("old savvy "), 100), 0755))
+	assert.NoError(t, os.WriteFile(newPath, bytes.Repeat([]byte("new savvy "), 100), 0755))
+
+	patches, err := GenerateRelease("savvy_linux_amd64", newPath, map[string]string{"v1.2.3": oldPath, "v1.1.0": oldPath, "v1.2.0": oldPath}, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "savvy_linux_amd64_from_1.1.0.patch"),
+		filepath.Join(dir, "savvy_linux_amd64_from_1.2.0.patch"),
+		filepath.Join(dir, "savvy_linux_amd64_from_1.2.3.patch"),
+	}, patches)
+
+	old, err := os.Open(oldPath)
+	assert.NoError(t, err)
+	defer old.Close()
+	patch, err := os.Open(patches[0])
+	assert.NoError(t, err)
+	defer patch.Close()
+	var out bytes.Buffer
+	assert.NoError(t, Patch(old, patch, &out))
+	assert.Equal(t, bytes.Repeat([]byte("new savvy "), 100), out.Bytes())
+}
+
+func TestSuffixArray(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, b := range [][]byte{nil, []byte("banana"), bytes.Repeat([]byte("ab"), 100), []byte("mississippi river")} {
+		sa := suffixArray(b)
+		assert.Len(t, sa, len(b)+1)
+		for i := 1; i < len(sa); i++ {
+			assert.Negative(t, bytes.Compare(b[sa[i-1]:], b[sa[i]:]), "%q", b)
+		}
+	}
+	b := make([]byte, 5000)
+	for i := range b {
+		b[i] = byte('a' + rng.Intn(3))
+	}
+	sa := suffixArray(b)
+	for i := 1; i < len(sa); i++ {
+		assert.Negative(t, bytes.Compare(b[sa[i-1]:], b[sa[i]:]))
+	}
+}
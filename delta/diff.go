@@ -0,0 +1,298 @@
+package delta
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Diff writes a patch that turns old into new to w.
+//
+// Diff holds a suffix array of old in memory, which takes about 16 times the size of old, so it is
+// meant to run when publishing a release rather than on users' machines.
+func Diff(old, new []byte, w io.Writer) error {
+	if int64(len(new)) > MaxSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrPatchTooLarge, len(new), MaxSize)
+	}
+	h := header{NewSize: int64(len(new))}
+	copy(h.Magic[:], magic)
+	if err := binary.Write(w, binary.BigEndian, h); err != nil {
+		return err
+	}
+
+	zw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	d := &differ{old: old, new: new, sa: suffixArray(old), w: zw}
+	if err := d.diff(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// differ finds the records of a patch, as described in "Naive differences of executable code" by
+// Colin Percival.
+type differ struct {
+	old, new []byte
+	// sa is the suffix array of old.
+	sa  []int
+	w   io.Writer
+	buf []byte
+}
+
+func (d *differ) diff() error {
+	old, new := d.old, d.new
+	var scan, pos, length int
+	var lastScan, lastPos, lastOffset int
+	for scan < len(new) {
+		oldScore := 0
+		scan += length
+		// find the next position where new matches old better than at the current offset.
+		for scsc := scan; scan < len(new); scan++ {
+			pos, length = d.search(new[scan:])
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < len(old) && old[scsc+lastOffset] == new[scsc] {
+					oldScore++
+				}
+			}
+			if (length == oldScore && length != 0) || length > oldScore+8 {
+				break
+			}
+			if scan+lastOffset < len(old) && old[scan+lastOffset] == new[scan] {
+				oldScore--
+			}
+		}
+		if length == oldScore && scan != len(new) {
+			continue
+		}
+
+		// extend the previous match forwards, and the new one backwards, while they are mostly equal.
+		var lenf int
+		for i, s, best := 0, 0, 0; lastScan+i < scan && lastPos+i < len(old); {
+			if old[lastPos+i] == new[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > best*2-lenf {
+				best, lenf = s, i
+			}
+		}
+		var lenb int
+		if scan < len(new) {
+			for i, s, best := 1, 0, 0; scan >= lastScan+i && pos >= i; i++ {
+				if old[pos-i] == new[scan-i] {
+					s++
+				}
+				if s*2-i > best*2-lenb {
+					best, lenb = s, i
+				}
+			}
+		}
+		if lastScan+lenf > scan-lenb {
+			overlap := lastScan + lenf - (scan - lenb)
+			var s, best, lens int
+			for i := 0; i < overlap; i++ {
+				if new[lastScan+lenf-overlap+i] == old[lastPos+lenf-overlap+i] {
+					s++
+				}
+				if new[scan-lenb+i] == old[pos-lenb+i] {
+					s--
+				}
+				if s > best {
+					best, lens = s, i+1
+				}
+			}
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		extra := scan - lenb - (lastScan + lenf)
+		c := control{Diff: int64(lenf), Extra: int64(extra), Seek: int64(pos - lenb - (lastPos + lenf))}
+		if err := d.write(c, lastScan, lastPos); err != nil {
+			return err
+		}
+		lastScan, lastPos, lastOffset = scan-lenb, pos-lenb, pos-scan
+	}
+	return nil
+}
+
+// write writes a record whose diff starts at newPos and oldPos.
+func (d *differ) write(c control, newPos, oldPos int) error {
+	if err := binary.Write(d.w, binary.BigEndian, c); err != nil {
+		return err
+	}
+	d.buf = append(d.buf[:0], d.new[newPos:newPos+int(c.Diff)+int(c.Extra)]...)
+	for i := 0; i < int(c.Diff); i++ {
+		d.buf[i] -= d.old[oldPos+i]
+	}
+	_, err := d.w.Write(d.buf)
+	return err
+}
+
+// search returns the position and length of the longest prefix of b found in old.
+func (d *differ) search(b []byte) (int, int) {
+	st, en := 0, len(d.old)
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		if bytes.Compare(d.old[d.sa[x]:], b[:min(len(b), len(d.old)-d.sa[x])]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+	x, y := matchLen(d.old[d.sa[st]:], b), matchLen(d.old[d.sa[en]:], b)
+	if x > y {
+		return d.sa[st], x
+	}
+	return d.sa[en], y
+}
+
+func matchLen(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// suffixArray returns the suffix array of b, including the empty suffix, using the qsufsort
+// algorithm by Larsson and Sadakane.
+func suffixArray(b []byte) []int {
+	n := len(b)
+	I := make([]int, n+1)
+	V := make([]int, n+1)
+
+	var buckets [256]int
+	for _, c := range b {
+		buckets[c]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+
+	for i, c := range b {
+		buckets[c]++
+		I[buckets[c]] = i
+	}
+	I[0] = n
+	for i, c := range b {
+		V[i] = buckets[c]
+	}
+	V[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			I[buckets[i]] = -1
+		}
+	}
+	I[0] = -1
+
+	for h := 1; I[0] != -(n + 1); h += h {
+		length := 0
+		i := 0
+		for i < n+1 {
+			if I[i] < 0 {
+				length -= I[i]
+				i -= I[i]
+			} else {
+				if length != 0 {
+					I[i-length] = -length
+				}
+				length = V[I[i]] + 1 - i
+				split(I, V, i, length, h)
+				i += length
+				length = 0
+			}
+		}
+		if length != 0 {
+			I[i-length] = -length
+		}
+	}
+
+	for i := 0; i < n+1; i++ {
+		I[V[i]] = i
+	}
+	return I
+}
+
+// split sorts the group of suffixes I[start:start+length] by their rank h bytes further on.
+func split(I, V []int, start, length, h int) {
+	if length < 16 {
+		for k := start; k < start+length; {
+			j := 1
+			x := V[I[k]+h]
+			for i := 1; k+i < start+length; i++ {
+				if V[I[k+i]+h] < x {
+					x = V[I[k+i]+h]
+					j = 0
+				}
+				if V[I[k+i]+h] == x {
+					I[k+j], I[k+i] = I[k+i], I[k+j]
+					j++
+				}
+			}
+			for i := 0; i < j; i++ {
+				V[I[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				I[k] = -1
+			}
+			k += j
+		}
+		return
+	}
+
+	x := V[I[start+length/2]+h]
+	var jj, kk int
+	for i := start; i < start+length; i++ {
+		if V[I[i]+h] < x {
+			jj++
+		}
+		if V[I[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, 0, 0
+	for i < jj {
+		switch {
+		case V[I[i]+h] < x:
+			i++
+		case V[I[i]+h] == x:
+			I[i], I[jj+j] = I[jj+j], I[i]
+			j++
+		default:
+			I[i], I[kk+k] = I[kk+k], I[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if V[I[jj+j]+h] == x {
+			j++
+		} else {
+			I[jj+j], I[kk+k] = I[kk+k], I[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		split(I, V, start, jj-start, h)
+	}
+	for i := 0; i < kk-jj; i++ {
+		V[I[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		I[jj] = -1
+	}
+	if start+length > kk {
+		split(I, V, kk, start+length-kk, h)
+	}
+}
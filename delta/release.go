@@ -0,0 +1,65 @@
+package delta
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Ext is the extension of patch assets.
+const Ext = ".patch"
+
+// PatchName returns the name of the release asset that patches the binary published as asset in
+// fromVersion, e.g "savvy_linux_amd64_from_1.2.3.patch" for asset "savvy_linux_amd64" and version "v1.2.3".
+func PatchName(asset, fromVersion string) string {
+	return fmt.Sprintf("%s_from_%s%s", asset, strings.TrimPrefix(fromVersion, "v"), Ext)
+}
+
+// DiffFile writes a patch that turns the file at oldPath into the file at newPath to patchPath.
+func DiffFile(oldPath, newPath, patchPath string) error {
+	old, err := os.ReadFile(oldPath)
+	if err != nil {
+		return err
+	}
+	new, err := os.ReadFile(newPath)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(patchPath)
+	if err != nil {
+		return err
+	}
+	if err := Diff(old, new, f); err != nil {
+		f.Close()
+		os.Remove(patchPath)
+		return err
+	}
+	return f.Close()
+}
+
+// GenerateRelease writes the patch assets for a release to dir and returns their paths, in the
+// lexical order of the versions.
+//
+// newPath is the binary published as the release asset called asset, and previous maps earlier
+// versions to the binary published as asset in that version. Patches are only worth publishing for
+// the versions most users are upgrading from, since each is roughly the size of the changes.
+func GenerateRelease(asset, newPath string, previous map[string]string, dir string) ([]string, error) {
+	// the patches are generated in a stable order, so that failures and the returned paths are reproducible.
+	versions := make([]string, 0, len(previous))
+	for version := range previous {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	var patches []string
+	for _, version := range versions {
+		path := filepath.Join(dir, PatchName(asset, version))
+		if err := DiffFile(previous[version], newPath, path); err != nil {
+			return patches, fmt.Errorf("failed to generate patch from %s: %w", version, err)
+		}
+		patches = append(patches, path)
+	}
+	return patches, nil
+}
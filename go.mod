@@ -4,11 +4,15 @@ go 1.21.6
 
 require (
 	github.com/hashicorp/go-version v1.6.0
+	github.com/klauspost/compress v1.17.11
 	github.com/stretchr/testify v1.8.4
+	github.com/ulikunitz/xz v0.5.15
+	lukechampine.com/blake3 v1.2.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.11 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,171 @@
+package upgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/install"
+	"github.com/getsavvyinc/upgrade-cli/lock"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+	"github.com/getsavvyinc/upgrade-cli/verify"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestUpgrader returns an upgrader for an executable containing installed, whose latest release
+// is v0.2.0 and "downloads" "new". opts are applied after the fakes, so they can replace them.
+func newTestUpgrader(t *testing.T, installed string, opts ...Opt) (string, *upgrader) {
+	t.Helper()
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "savvy")
+	assert.NoError(t, os.WriteFile(executable, []byte(installed), 0755))
+	opts = append([]Opt{
+		WithAssetDownloader(fakeDownloader{dir: dir, content: "new"}),
+		WithCheckSumDownloader(fakeChecksums{}),
+		WithCheckSumValidator(fakeChecksums{}),
+		WithoutFormatCheck(),
+		WithAllowManagedInstall(),
+	}, opts...)
+	u := NewUpgrader("getsavvyinc", "savvy-cli", executable, opts...).(*upgrader)
+	u.releaseGetter = fakeReleaseGetter{tag: "v0.2.0"}
+	return executable, u
+}
+
+// newTestInstall returns the items installing "new" over a file containing "old", and the file.
+func newTestInstall(t *testing.T) (string, []install.Item) {
+	t.Helper()
+	dir := t.TempDir()
+	target := filepath.Join(dir, "savvy")
+	assert.NoError(t, os.WriteFile(target, []byte("old"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "savvy.new"), []byte("new"), 0755))
+	return target, []install.Item{{Source: filepath.Join(dir, "savvy.new"), Target: target}}
+}
+
+// backupOf returns the path the file at path is backed up to while it is replaced.
+func backupOf(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".upgrade-backup")
+}
+
+func assertContent(t *testing.T, path, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, want, string(data))
+}
+
+// assertOnlyExecutable asserts that the directory containing executable holds nothing else but its lock file.
+func assertOnlyExecutable(t *testing.T, executable string) {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Dir(executable))
+	assert.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{filepath.Base(executable), filepath.Base(lock.Path(executable))}, names)
+}
+
+type fakeReleaseGetter struct{ tag string }
+
+func (g fakeReleaseGetter) GetLatestRelease(ctx context.Context) (*release.Info, error) {
+	return &release.Info{TagName: g.tag, Assets: []release.Asset{{Name: "savvy_linux_amd64"}}}, nil
+}
+
+type releaseFunc func() *release.Info
+
+func (f releaseFunc) GetLatestRelease(ctx context.Context) (*release.Info, error) {
+	return f(), nil
+}
+
+// fakeDownloader "downloads" content to a new file in dir, as the asset called name if it is set.
+type fakeDownloader struct {
+	dir     string
+	content string
+	name    string
+}
+
+func (d fakeDownloader) DownloadAsset(ctx context.Context, assets []release.Asset) (*asset.Info, func() error, error) {
+	f, err := os.CreateTemp(d.dir, "download-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(d.content); err != nil {
+		return nil, nil, err
+	}
+	info := &asset.Info{
+		Asset:                    assets[0],
+		Checksum:                 "digest",
+		DownloadedBinaryFilePath: f.Name(),
+	}
+	if d.name != "" {
+		info.Asset = release.Asset{Name: d.name}
+	}
+	return info, func() error { return os.Remove(f.Name()) }, nil
+}
+
+// assetServer "downloads" release assets from memory and records the full downloads. Downloads of
+// the assets in errs fail.
+type assetServer struct {
+	dir       string
+	assets    map[string][]byte
+	errs      map[string]error
+	downloads []string
+}
+
+func (s *assetServer) SelectAsset(info *release.Info) (release.Asset, bool) {
+	return release.Asset{Name: "savvy_linux_amd64"}, true
+}
+
+func (s *assetServer) DownloadAsset(ctx context.Context, assets []release.Asset) (*asset.Info, func() error, error) {
+	a, _ := s.SelectAsset(&release.Info{Assets: assets})
+	s.downloads = append(s.downloads, a.Name)
+	return s.Fetch(ctx, a)
+}
+
+func (s *assetServer) Fetch(ctx context.Context, a release.Asset) (*asset.Info, func() error, error) {
+	if err := s.errs[a.Name]; err != nil {
+		return nil, nil, err
+	}
+	path := filepath.Join(s.dir, a.Name)
+	if err := os.WriteFile(path, s.assets[a.Name], 0755); err != nil {
+		return nil, nil, err
+	}
+	info, err := asset.NewFileInfo(a, path)
+	return info, func() error { return os.Remove(path) }, err
+}
+
+func (s *assetServer) release(tag string) *release.Info {
+	info := &release.Info{TagName: tag}
+	for name := range s.assets {
+		info.Assets = append(info.Assets, release.Asset{Name: name})
+	}
+	return info
+}
+
+// fakeChecksums accepts any checksum.
+type fakeChecksums struct{}
+
+func (fakeChecksums) Download(ctx context.Context, assets []release.Asset) (*checksum.Info, error) {
+	return &checksum.Info{Algorithm: checksum.SHA256}, nil
+}
+
+func (fakeChecksums) IsCheckSumValid(ctx context.Context, binary string, checksums *checksum.Info, downloadedChecksum string) bool {
+	return true
+}
+
+// digestValidator accepts a single sha256 digest.
+type digestValidator struct{ want string }
+
+func (v digestValidator) IsCheckSumValid(ctx context.Context, binary string, checksums *checksum.Info, downloadedChecksum string) bool {
+	return downloadedChecksum == v.want
+}
+
+type verifierFunc func(ctx context.Context, c verify.Candidate) error
+
+func (f verifierFunc) Verify(ctx context.Context, c verify.Candidate) error {
+	return f(ctx, c)
+}
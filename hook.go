@@ -0,0 +1,98 @@
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+var (
+	// ErrHookFailed means a post-upgrade hook returned an error.
+	ErrHookFailed = errors.New("post-upgrade hook failed")
+	// ErrHooksNotEscalatable means an upgrade with hooks needs privilege escalation, whose install
+	// step can't be rolled back if a hook fails.
+	ErrHooksNotEscalatable = errors.New("post-upgrade hooks can't be rolled back with privilege escalation")
+)
+
+// Environment variables set when running a migration command.
+const (
+	FromVersionEnv = "UPGRADE_CLI_FROM_VERSION"
+	ToVersionEnv   = "UPGRADE_CLI_TO_VERSION"
+)
+
+// HookInfo describes the upgrade a hook runs after.
+type HookInfo struct {
+	// FromVersion is the version that was replaced.
+	FromVersion string
+	// ToVersion is the version that was installed.
+	ToVersion string
+	// ExecutablePath is the path of the new executable.
+	ExecutablePath string
+	Release        *release.Info
+}
+
+// Hook runs after the new version has been installed, e.g to migrate configuration or regenerate completions.
+type Hook func(ctx context.Context, info HookInfo) error
+
+// WithPostUpgradeHook adds a hook that runs after the new version is installed.
+//
+// Hooks run in the order they were added. If one fails, the remaining hooks don't run and the previous
+// version is restored, unless WithoutRollbackOnHookFailure is used. The previous version is also
+// restored by Recover if the upgrade is interrupted while hooks run.
+//
+// The privileged install step of WithPrivilegeEscalation can't be rolled back, so an upgrade that
+// needs it fails with an error wrapping ErrHooksNotEscalatable before anything is downloaded, unless
+// WithoutRollbackOnHookFailure is used.
+func WithPostUpgradeHook(h Hook) Opt {
+	return func(u *upgrader) {
+		u.hooks = append(u.hooks, h)
+	}
+}
+
+// WithMigrationCommand adds a hook that runs the new executable with args, e.g "migrate".
+//
+// See MigrationHook for how the versions are passed to the command.
+func WithMigrationCommand(args ...string) Opt {
+	return WithPostUpgradeHook(MigrationHook(args...))
+}
+
+// WithoutRollbackOnHookFailure keeps the new version installed if a hook fails. Upgrade still returns
+// an error wrapping ErrHookFailed.
+func WithoutRollbackOnHookFailure() Opt {
+	return func(u *upgrader) {
+		u.keepOnHookFailure = true
+	}
+}
+
+// MigrationHook returns a hook that runs the new executable with args, followed by --from and --to
+// flags holding the previous and new versions. The versions are also set in the FromVersionEnv and
+// ToVersionEnv environment variables.
+func MigrationHook(args ...string) Hook {
+	return func(ctx context.Context, info HookInfo) error {
+		args := append(append([]string{}, args...), "--from", info.FromVersion, "--to", info.ToVersion)
+		cmd := exec.CommandContext(ctx, info.ExecutablePath, args...)
+		cmd.Env = append(os.Environ(), FromVersionEnv+"="+info.FromVersion, ToVersionEnv+"="+info.ToVersion)
+		var output bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &output, &output
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s %s: %w: %s", info.ExecutablePath, strings.Join(args, " "), err, strings.TrimSpace(output.String()))
+		}
+		return nil
+	}
+}
+
+// runHooks runs every hook, stopping at the first that fails.
+func (u *upgrader) runHooks(ctx context.Context, info HookInfo) error {
+	for i, h := range u.hooks {
+		if err := h(ctx, info); err != nil {
+			return fmt.Errorf("%w: hook %d: %w", ErrHookFailed, i+1, err)
+		}
+	}
+	return nil
+}
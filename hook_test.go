@@ -0,0 +1,144 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/install"
+	"github.com/getsavvyinc/upgrade-cli/lock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostUpgradeHooks(t *testing.T) {
+	ctx := context.Background()
+	errMigration := errors.New("migration failed")
+
+	t.Run("HooksRunInOrder", func(t *testing.T) {
+		target, items := newTestInstall(t)
+		var calls []string
+		u := &upgrader{installPath: target}
+		for _, name := range []string{"first", "second"} {
+			name := name
+			WithPostUpgradeHook(func(ctx context.Context, info HookInfo) error {
+				// the new version is installed when hooks run.
+				assertContent(t, info.ExecutablePath, "new")
+				calls = append(calls, name+" "+info.FromVersion+" "+info.ToVersion)
+				return nil
+			})(u)
+		}
+		assert.NoError(t, u.replaceBinary(ctx, items, HookInfo{FromVersion: "0.1.0", ToVersion: "0.2.0", ExecutablePath: target}))
+		assert.Equal(t, []string{"first 0.1.0 0.2.0", "second 0.1.0 0.2.0"}, calls)
+		assertContent(t, target, "new")
+		assert.NoFileExists(t, backupOf(target))
+	})
+	t.Run("RollbackOnFailure", func(t *testing.T) {
+		target, items := newTestInstall(t)
+		called := false
+		u := &upgrader{installPath: target}
+		WithPostUpgradeHook(func(ctx context.Context, info HookInfo) error { return errMigration })(u)
+		WithPostUpgradeHook(func(ctx context.Context, info HookInfo) error { called = true; return nil })(u)
+
+		err := u.replaceBinary(ctx, items, HookInfo{ExecutablePath: target})
+		assert.ErrorIs(t, err, ErrHookFailed)
+		assert.ErrorIs(t, err, errMigration)
+		assert.False(t, called)
+		assertContent(t, target, "old")
+		assert.NoFileExists(t, backupOf(target))
+	})
+	t.Run("RecoverDuringHook", func(t *testing.T) {
+		target, items := newTestInstall(t)
+		// Upgrade holds the lock while hooks run.
+		l, err := lock.Acquire(ctx, target, 0)
+		assert.NoError(t, err)
+		defer l.Release()
+		u := &upgrader{installPath: target}
+		WithPostUpgradeHook(func(ctx context.Context, info HookInfo) error {
+			// e.g the new version recovers on start up while running a migration, and the migration fails.
+			assert.NoError(t, Recover(info.ExecutablePath))
+			return errMigration
+		})(u)
+
+		err = u.replaceBinary(ctx, items, HookInfo{ExecutablePath: target})
+		assert.ErrorIs(t, err, ErrHookFailed)
+		assert.NotErrorIs(t, err, install.ErrBackupMissing)
+		assertContent(t, target, "old")
+		assert.NoFileExists(t, backupOf(target))
+	})
+	t.Run("KeepOnFailure", func(t *testing.T) {
+		target, items := newTestInstall(t)
+		u := &upgrader{installPath: target}
+		WithPostUpgradeHook(func(ctx context.Context, info HookInfo) error { return errMigration })(u)
+		WithoutRollbackOnHookFailure()(u)
+
+		err := u.replaceBinary(ctx, items, HookInfo{ExecutablePath: target})
+		assert.ErrorIs(t, err, ErrHookFailed)
+		assertContent(t, target, "new")
+		assert.NoFileExists(t, backupOf(target))
+	})
+}
+
+func TestEscalatedHooks(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Getuid() == 0 {
+		t.Skip("directory permissions can't be enforced")
+	}
+	ctx := context.Background()
+	hook := WithPostUpgradeHook(func(ctx context.Context, info HookInfo) error { return nil })
+
+	tests := []struct {
+		name    string
+		opts    []Opt
+		wantErr bool
+	}{
+		{name: "Rollback", opts: []Opt{hook}, wantErr: true},
+		{name: "KeepOnFailure", opts: []Opt{hook, WithoutRollbackOnHookFailure()}},
+		{name: "NoHooks"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			executable, u := newTestUpgrader(t, "old", append([]Opt{WithPrivilegeEscalation()}, tc.opts...)...)
+			dir := filepath.Dir(executable)
+			assert.NoError(t, os.Chmod(dir, 0555))
+			t.Cleanup(func() { os.Chmod(dir, 0755) })
+
+			upd, err := u.prepare(ctx, "0.1.0", true)
+			if upd != nil {
+				upd.cleanup()
+			}
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrHooksNotEscalatable)
+				assert.ErrorIs(t, err, install.ErrPermissionDenied)
+			} else {
+				assert.NotErrorIs(t, err, ErrHooksNotEscalatable)
+			}
+		})
+	}
+}
+
+func TestMigrationHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts can't be executed on windows")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "savvy")
+	out := filepath.Join(dir, "out")
+	script := "#!/bin/sh\necho \"$@ $" + FromVersionEnv + " $" + ToVersionEnv + "\" > " + out + "\n"
+	assert.NoError(t, os.WriteFile(executable, []byte(script), 0755))
+
+	info := HookInfo{FromVersion: "0.1.0", ToVersion: "0.2.0", ExecutablePath: executable}
+	assert.NoError(t, MigrationHook("migrate", "--quiet")(ctx, info))
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "migrate --quiet --from 0.1.0 --to 0.2.0 0.1.0 0.2.0\n", string(data))
+
+	t.Run("Failure", func(t *testing.T) {
+		failing := filepath.Join(dir, "failing")
+		assert.NoError(t, os.WriteFile(failing, []byte("#!/bin/sh\necho 'unknown schema' >&2\nexit 1\n"), 0755))
+		err := MigrationHook("migrate")(ctx, HookInfo{ExecutablePath: failing})
+		assert.ErrorContains(t, err, "unknown schema")
+	})
+}
@@ -0,0 +1,27 @@
+package install
+
+import (
+	"fmt"
+	"os"
+)
+
+// copyAttributes applies the mode, ownership and extended attributes of the file at from to the file at to.
+//
+// Ownership is changed first because it clears the setuid bits and file capabilities on some
+// platforms. It is only copied when permitted, e.g when running as root.
+func copyAttributes(from, to string) error {
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	if err := copyOwner(info, to); err != nil {
+		return fmt.Errorf("failed to copy ownership of %s: %w", from, err)
+	}
+	if err := os.Chmod(to, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return fmt.Errorf("failed to copy mode of %s: %w", from, err)
+	}
+	if err := copyXattrs(from, to); err != nil {
+		return fmt.Errorf("failed to copy extended attributes of %s: %w", from, err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package install
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isCrossDevice reports whether err was returned by renaming a file to another filesystem.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
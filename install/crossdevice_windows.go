@@ -0,0 +1,14 @@
+package install
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, which MoveFileEx returns when moving a file to another volume.
+const errorNotSameDevice syscall.Errno = 17
+
+// isCrossDevice reports whether err was returned by renaming a file to another volume.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
@@ -0,0 +1,442 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Item is a file to install.
+type Item struct {
+	// Source is the verified file to install. It is moved next to Target, or copied if it
+	// is on another filesystem, and then renamed over Target.
+	Source string
+	// Target is the path to install Source at.
+	Target string
+	// Mode overrides the permissions Source is installed with. By default it gets the permissions of
+	// the file it replaces, or keeps its own if there is none.
+	Mode os.FileMode
+}
+
+// Transaction installs one or more files as a single unit.
+//
+// Apply replaces every target, keeping a backup of the files it replaces. The backups are
+// removed by Commit, or restored by Rollback. Progress is recorded in a journal next to the
+// transaction's anchor so that Recover can finish or undo a transaction that was interrupted.
+type Transaction struct {
+	journal *journal
+	applied bool
+	// uncommitted makes Recover roll back the applied transaction instead of committing it.
+	uncommitted bool
+}
+
+var (
+	ErrNothingToInstall = errors.New("nothing to install")
+	// ErrBackupMissing means a file replaced by a transaction can't be restored, because its backup was removed.
+	ErrBackupMissing = errors.New("backup is missing")
+)
+
+// NewTransaction returns a Transaction for items, whose journal is kept next to anchor.
+//
+// anchor is the path Recover is called with, e.g the executable, which needn't be the first item.
+func NewTransaction(anchor string, items ...Item) *Transaction {
+	j := &journal{path: journalPath(anchor), anchor: anchor}
+	for _, item := range items {
+		j.Items = append(j.Items, journalItem{
+			Source: item.Source,
+			Target: item.Target,
+			Backup: backupPath(item.Target),
+			Mode:   item.Mode,
+		})
+	}
+	return &Transaction{journal: j}
+}
+
+// Replace atomically replaces target with source.
+//
+// The previous target is kept as a backup until source is in place, and restored if the
+// replacement fails.
+func Replace(source, target string) error {
+	tx := NewTransaction(target, Item{Source: source, Target: target})
+	if err := tx.Apply(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RollbackUnlessCommitted makes Recover roll the transaction back if it is interrupted after Apply,
+// rather than commit it. Use it when the transaction is only complete once something that runs
+// after Apply succeeds, e.g post-upgrade hooks.
+func (t *Transaction) RollbackUnlessCommitted() {
+	t.uncommitted = true
+}
+
+// Apply installs every item.
+//
+// If any item cannot be installed, the targets that were already replaced are restored and an
+// error is returned.
+func (t *Transaction) Apply() error {
+	j := t.journal
+	if len(j.Items) == 0 {
+		return ErrNothingToInstall
+	}
+	if err := j.prepare(); err != nil {
+		return errors.Join(err, j.cleanupPrepared())
+	}
+
+	j.State = stateSwapping
+	if err := j.write(); err != nil {
+		return errors.Join(err, j.cleanupPrepared())
+	}
+
+	for i := range j.Items {
+		item := &j.Items[i]
+		if err := os.Rename(item.Source, item.Target); err != nil {
+			err = fmt.Errorf("failed to install %s: %w", item.Target, err)
+			return errors.Join(err, j.undo())
+		}
+	}
+	if err := j.syncDirs(); err != nil {
+		return errors.Join(err, j.undo())
+	}
+
+	j.State = stateApplied
+	if t.uncommitted {
+		j.State = stateUncommitted
+	}
+	if err := j.write(); err != nil {
+		return errors.Join(err, j.undo())
+	}
+	t.applied = true
+	return nil
+}
+
+// Commit discards the backups of an applied transaction.
+func (t *Transaction) Commit() error {
+	if !t.applied {
+		return errors.New("transaction has not been applied")
+	}
+	t.applied = false
+	return t.journal.finish()
+}
+
+// Rollback restores the backups of an applied transaction.
+func (t *Transaction) Rollback() error {
+	if !t.applied {
+		return errors.New("transaction has not been applied")
+	}
+	t.applied = false
+	return t.journal.undo()
+}
+
+// Recover finishes or undoes a transaction anchored at target that was interrupted, e.g because the
+// process was killed.
+//
+// Transactions that were fully applied are committed, unless RollbackUnlessCommitted was used.
+// Transactions that were interrupted while replacing files are rolled back. Recover does nothing if
+// there is no such transaction.
+func Recover(target string) error {
+	j, err := readJournal(journalPath(target))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	j.anchor = target
+
+	switch j.State {
+	case statePrepared:
+		return j.cleanupPrepared()
+	case stateSwapping, stateUncommitted:
+		return j.undo()
+	case stateRestored:
+		return j.finish()
+	case stateApplied:
+		return j.finish()
+	}
+	return fmt.Errorf("unknown transaction state %q in %s", j.State, j.path)
+}
+
+// prepare copies the attributes of every existing target to its source, flushes every source to
+// disk, backs up every existing target and records the transaction in the journal.
+func (j *journal) prepare() error {
+	for i := range j.Items {
+		item := &j.Items[i]
+		// only a rename within a directory is atomic, so sources elsewhere are staged next to the target first.
+		if filepath.Dir(item.Source) != filepath.Dir(item.Target) {
+			staged, err := stage(item.Source, item.Target, j.anchor)
+			if err != nil {
+				return fmt.Errorf("failed to stage %s: %w", item.Source, err)
+			}
+			item.Source, item.Staged = staged, true
+		}
+		if err := os.Remove(item.Backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale backup %s: %w", item.Backup, err)
+		}
+		_, err := os.Lstat(item.Target)
+		exists := err == nil
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		// the new file replaces the existing one, so it gets the same mode, owner and extended attributes.
+		if exists {
+			if err := copyAttributes(item.Target, item.Source); err != nil {
+				return err
+			}
+		}
+		if item.Mode != 0 {
+			if err := os.Chmod(item.Source, item.Mode); err != nil {
+				return err
+			}
+		}
+		if err := syncFile(item.Source); err != nil {
+			return fmt.Errorf("failed to sync %s: %w", item.Source, err)
+		}
+		if !exists {
+			continue
+		}
+		if err := backup(item.Target, item.Backup); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", item.Target, err)
+		}
+		item.HasBackup = true
+	}
+	if err := j.syncDirs(); err != nil {
+		return err
+	}
+
+	j.State = statePrepared
+	return j.write()
+}
+
+// undo restores every target from its backup and removes the backups and the journal.
+//
+// The backups are kept until every target was restored, so that an undo that fails or is interrupted
+// can be retried by Recover.
+func (j *journal) undo() error {
+	var errs []error
+	for _, item := range j.Items {
+		if item.HasBackup {
+			if err := restore(item.Backup, item.Target, j.anchor); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore %s: %w", item.Target, err))
+			}
+			continue
+		}
+		// the target didn't exist before the transaction, so it is removed unless it was never installed.
+		if _, err := os.Lstat(item.Source); errors.Is(err, os.ErrNotExist) {
+			if err := os.Remove(item.Target); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("failed to remove %s: %w", item.Target, err))
+			}
+		}
+	}
+	if err := j.syncDirs(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		// keep the journal so that Recover can try again.
+		return errors.Join(errs...)
+	}
+
+	j.State = stateRestored
+	if err := j.write(); err != nil {
+		return err
+	}
+	return j.finish()
+}
+
+// finish removes the backups, staged sources and the journal of an applied transaction.
+func (j *journal) finish() error {
+	errs := []error{j.removeStaged()}
+	for _, item := range j.Items {
+		if item.HasBackup {
+			if err := os.Remove(item.Backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := j.remove(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// removeStaged removes the staged sources that weren't installed.
+func (j *journal) removeStaged() error {
+	var errs []error
+	for _, item := range j.Items {
+		if item.Staged {
+			if err := os.Remove(item.Source); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cleanupPrepared removes the backups and the journal of a transaction that never replaced a target.
+func (j *journal) cleanupPrepared() error {
+	return j.finish()
+}
+
+func (j *journal) syncDirs() error {
+	seen := make(map[string]bool)
+	for _, item := range j.Items {
+		dir := filepath.Dir(item.Target)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		if err := syncDir(dir); err != nil {
+			return fmt.Errorf("failed to sync %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// backupPath returns the path the file at target is backed up to, e.g .savvy.upgrade-backup.
+//
+// The name is in the namespace of upgrade files, so that a stale backup can be removed without
+// removing a file of the user's, e.g savvy.bak.
+func backupPath(target string) string {
+	return filepath.Join(filepath.Dir(target), tempPrefix(target)+"backup")
+}
+
+// backup hard links target to path, falling back to a copy if the filesystem doesn't support links.
+func backup(target, path string) error {
+	if err := os.Link(target, path); err == nil {
+		return nil
+	}
+	return copyFile(target, path, os.O_CREATE|os.O_EXCL)
+}
+
+// restore replaces target with the backup at path, keeping the backup. Its temporary file is named
+// after anchor, like every temporary file of the transaction.
+//
+// The backup is linked over target, so restoring a target that was already restored, or never
+// replaced, does nothing. It returns an error wrapping ErrBackupMissing if there is no backup.
+func restore(path, target, anchor string) error {
+	backupInfo, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrBackupMissing, path)
+	}
+	if err != nil {
+		return err
+	}
+	if targetInfo, err := os.Lstat(target); err == nil && os.SameFile(backupInfo, targetInfo) {
+		return nil
+	}
+
+	tmp := filepath.Join(filepath.Dir(target), tempPrefix(anchor)+"restore"+tempSuffix)
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := backup(path, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// stage moves source to a new file next to target, named after anchor so that Sweep finds it, and
+// returns its path.
+//
+// If source is on another filesystem, it is copied instead.
+func stage(source, target, anchor string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(target), TempPattern(anchor))
+	if err != nil {
+		return "", err
+	}
+	staged := f.Name()
+	f.Close()
+
+	err = os.Rename(source, staged)
+	if isCrossDevice(err) {
+		err = copyFile(source, staged, os.O_TRUNC)
+	}
+	if err != nil {
+		os.Remove(staged)
+		return "", err
+	}
+	return staged, nil
+}
+
+// Move moves source to target, replacing it if it exists.
+//
+// If source is on another filesystem, it is copied and then removed. Unlike Replace, target isn't
+// replaced atomically, so Move is meant for files that aren't in use, e.g to keep a downloaded update.
+func Move(source, target string) error {
+	err := os.Rename(source, target)
+	if isCrossDevice(err) {
+		if err = copyFile(source, target, os.O_CREATE|os.O_TRUNC); err == nil {
+			err = os.Remove(source)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(target))
+}
+
+// copyFile copies src and its permissions to dst, which is opened with flag.
+func copyFile(src, dst string, flag int) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|flag, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// syncDir flushes the directory entry changes in dir to disk.
+func syncDir(dir string) error {
+	// directories can't be opened for syncing on windows, where renames are flushed by the filesystem.
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
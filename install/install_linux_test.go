@@ -0,0 +1,73 @@
+package install
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplacePreservesOwnerAndXattrs(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "savvy")
+	source := filepath.Join(dir, "savvy.new")
+	writeFile(t, target, "old")
+	writeFile(t, source, "new")
+
+	isRoot := os.Getuid() == 0
+	if isRoot {
+		assert.NoError(t, os.Chown(target, 1234, 5678))
+	}
+	// not every filesystem supports user extended attributes.
+	hasXattr := syscall.Setxattr(target, "user.upgrade-cli", []byte("value"), 0) == nil
+	if !isRoot && !hasXattr {
+		t.Skip("changing ownership and extended attributes isn't supported")
+	}
+
+	assert.NoError(t, Replace(source, target))
+	info, err := os.Stat(target)
+	assert.NoError(t, err)
+	if isRoot {
+		stat := info.Sys().(*syscall.Stat_t)
+		assert.Equal(t, uint32(1234), stat.Uid)
+		assert.Equal(t, uint32(5678), stat.Gid)
+	}
+	if hasXattr {
+		value, err := getXattr(target, "user.upgrade-cli")
+		assert.NoError(t, err)
+		assert.Equal(t, "value", string(value))
+	}
+}
+
+func TestReplaceAcrossFilesystems(t *testing.T) {
+	// /dev/shm is a tmpfs, so it is usually on another filesystem than the temp dir.
+	shm, err := os.MkdirTemp("/dev/shm", "upgrade-cli-test")
+	if err != nil {
+		t.Skip("/dev/shm isn't available")
+	}
+	t.Cleanup(func() { os.RemoveAll(shm) })
+	dir := t.TempDir()
+	probe := filepath.Join(shm, "probe")
+	writeFile(t, probe, "")
+	if err := os.Rename(probe, filepath.Join(dir, "probe")); !errors.Is(err, syscall.EXDEV) {
+		t.Skip("/dev/shm is on the same filesystem as the temp dir")
+	}
+
+	target := filepath.Join(dir, "savvy")
+	source := filepath.Join(shm, "savvy.new")
+	writeFile(t, target, "old")
+	writeFile(t, source, "new")
+	assert.NoError(t, os.Chmod(target, 0750))
+
+	assert.NoError(t, Replace(source, target))
+	assert.Equal(t, "new", readFile(t, target))
+	info, err := os.Stat(target)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	assertOnly(t, dir, "savvy")
+	// the source is copied, and left for the caller to remove.
+	assert.FileExists(t, source)
+}
@@ -0,0 +1,300 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0755))
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+// assertOnly asserts that dir contains exactly names.
+func assertOnly(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	assert.ElementsMatch(t, names, got)
+}
+
+func TestReplace(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "savvy")
+	source := filepath.Join(dir, "savvy.new")
+	writeFile(t, target, "old")
+	writeFile(t, source, "new")
+
+	assert.NoError(t, Replace(source, target))
+	assert.Equal(t, "new", readFile(t, target))
+	assertOnly(t, dir, "savvy")
+}
+
+func TestReplaceFromOtherDir(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "savvy")
+	source := filepath.Join(t.TempDir(), "savvy.new")
+	writeFile(t, target, "old")
+	writeFile(t, source, "new")
+
+	assert.NoError(t, Replace(source, target))
+	assert.Equal(t, "new", readFile(t, target))
+	assert.NoFileExists(t, source)
+	assertOnly(t, dir, "savvy")
+
+	t.Run("RemoveStagedOnFailure", func(t *testing.T) {
+		// renaming a file over a non-empty directory fails after the source was staged.
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, "busy", "file"), 0755))
+		source := filepath.Join(t.TempDir(), "busy.new")
+		writeFile(t, source, "new busy")
+		assert.Error(t, Replace(source, filepath.Join(dir, "busy")))
+		assertOnly(t, dir, "savvy", "busy")
+	})
+}
+
+func TestReplacePreservesMode(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "savvy")
+	source := filepath.Join(dir, "savvy.new")
+	writeFile(t, target, "old")
+	writeFile(t, source, "new")
+	assert.NoError(t, os.Chmod(target, 0750))
+
+	assert.NoError(t, Replace(source, target))
+	info, err := os.Stat(target)
+	assert.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	setup := func(t *testing.T) (string, []Item) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "savvy"), "old")
+		writeFile(t, filepath.Join(dir, "savvy.new"), "new")
+		writeFile(t, filepath.Join(dir, "helper.new"), "new helper")
+		return dir, []Item{
+			{Source: filepath.Join(dir, "savvy.new"), Target: filepath.Join(dir, "savvy")},
+			{Source: filepath.Join(dir, "helper.new"), Target: filepath.Join(dir, "helper")},
+		}
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		dir, items := setup(t)
+		tx := NewTransaction(items[0].Target, items...)
+		assert.NoError(t, tx.Apply())
+		assert.Equal(t, "new", readFile(t, filepath.Join(dir, "savvy")))
+		assert.Equal(t, "old", readFile(t, filepath.Join(dir, ".savvy.upgrade-backup")))
+		assert.FileExists(t, journalPath(items[0].Target))
+
+		assert.NoError(t, tx.Commit())
+		assert.Equal(t, "new helper", readFile(t, filepath.Join(dir, "helper")))
+		assertOnly(t, dir, "savvy", "helper")
+	})
+	t.Run("Rollback", func(t *testing.T) {
+		dir, items := setup(t)
+		tx := NewTransaction(items[0].Target, items...)
+		assert.NoError(t, tx.Apply())
+		assert.NoError(t, tx.Rollback())
+		assert.Equal(t, "old", readFile(t, filepath.Join(dir, "savvy")))
+		// helper didn't exist before the transaction
+		assertOnly(t, dir, "savvy")
+		assert.Error(t, tx.Commit())
+	})
+	t.Run("RollbackMissingBackup", func(t *testing.T) {
+		dir, items := setup(t)
+		tx := NewTransaction(items[0].Target, items...)
+		assert.NoError(t, tx.Apply())
+		assert.NoError(t, os.Remove(filepath.Join(dir, ".savvy.upgrade-backup")))
+
+		assert.ErrorIs(t, tx.Rollback(), ErrBackupMissing)
+		// the journal is kept, so that the failure isn't forgotten.
+		assert.FileExists(t, journalPath(items[0].Target))
+	})
+	t.Run("AnchorNotFirst", func(t *testing.T) {
+		// e.g a completion is installed before the executable, whose path Recover is called with.
+		dir, items := setup(t)
+		writeFile(t, filepath.Join(dir, "helper"), "old helper")
+		items[0], items[1] = items[1], items[0]
+		tx := NewTransaction(filepath.Join(dir, "savvy"), items...)
+		tx.RollbackUnlessCommitted()
+		assert.NoError(t, tx.Apply())
+
+		assert.NoError(t, Recover(filepath.Join(dir, "savvy")))
+		assert.Equal(t, "old", readFile(t, filepath.Join(dir, "savvy")))
+		assert.Equal(t, "old helper", readFile(t, filepath.Join(dir, "helper")))
+		assertOnly(t, dir, "savvy", "helper")
+	})
+	t.Run("StagedNamedAfterAnchor", func(t *testing.T) {
+		// e.g a completion is installed in another directory than the executable.
+		dir, items := setup(t)
+		other := t.TempDir()
+		items[1].Target = filepath.Join(other, "helper")
+		j := NewTransaction(items[0].Target, items...).journal
+		assert.NoError(t, j.prepare())
+		assert.True(t, strings.HasPrefix(filepath.Base(j.Items[1].Source), tempPrefix(filepath.Join(dir, "savvy"))))
+		assert.NoError(t, j.cleanupPrepared())
+		assertOnly(t, other)
+	})
+	t.Run("KeepUserBackup", func(t *testing.T) {
+		// savvy.bak belongs to the user, not to an earlier upgrade.
+		dir, items := setup(t)
+		writeFile(t, filepath.Join(dir, "savvy.bak"), "mine")
+		tx := NewTransaction(items[0].Target, items...)
+		assert.NoError(t, tx.Apply())
+		assert.NoError(t, tx.Commit())
+		assert.Equal(t, "mine", readFile(t, filepath.Join(dir, "savvy.bak")))
+		assertOnly(t, dir, "savvy", "savvy.bak", "helper")
+	})
+	t.Run("RestoreOnFailure", func(t *testing.T) {
+		dir, items := setup(t)
+		items = append(items, Item{Source: filepath.Join(dir, "missing.new"), Target: filepath.Join(dir, "missing")})
+		// the missing source fails before anything is replaced.
+		assert.Error(t, NewTransaction(items[0].Target, items...).Apply())
+		assert.Equal(t, "old", readFile(t, filepath.Join(dir, "savvy")))
+		assertOnly(t, dir, "savvy", "savvy.new", "helper.new")
+	})
+	t.Run("RestoreOnFailedRename", func(t *testing.T) {
+		dir, items := setup(t)
+		// renaming a file over a non-empty directory fails after savvy was replaced.
+		busy := filepath.Join(dir, "busy")
+		assert.NoError(t, os.MkdirAll(filepath.Join(busy, "file"), 0755))
+		writeFile(t, filepath.Join(dir, "busy.new"), "new busy")
+		items = append(items, Item{Source: filepath.Join(dir, "busy.new"), Target: busy})
+
+		assert.Error(t, NewTransaction(items[0].Target, items...).Apply())
+		assert.Equal(t, "old", readFile(t, filepath.Join(dir, "savvy")))
+		assert.NoFileExists(t, filepath.Join(dir, "helper"))
+		assert.NoFileExists(t, journalPath(items[0].Target))
+		assert.DirExists(t, filepath.Join(busy, "file"))
+	})
+	t.Run("Mode", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("permissions aren't supported on windows")
+		}
+		dir, items := setup(t)
+		items[0].Mode, items[1].Mode = 0700, 0640
+		tx := NewTransaction(items[0].Target, items...)
+		assert.NoError(t, tx.Apply())
+		assert.NoError(t, tx.Commit())
+		for _, item := range items {
+			info, err := os.Stat(item.Target)
+			assert.NoError(t, err)
+			assert.Equal(t, item.Mode, info.Mode().Perm())
+		}
+		assertOnly(t, dir, "savvy", "helper")
+	})
+	t.Run("NothingToInstall", func(t *testing.T) {
+		assert.ErrorIs(t, NewTransaction(filepath.Join(t.TempDir(), "savvy")).Apply(), ErrNothingToInstall)
+	})
+}
+
+func TestMove(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "savvy.new")
+	target := filepath.Join(t.TempDir(), "savvy")
+	writeFile(t, source, "new")
+	writeFile(t, target, "old")
+
+	assert.NoError(t, Move(source, target))
+	assert.Equal(t, "new", readFile(t, target))
+	assert.NoFileExists(t, source)
+}
+
+func TestRecover(t *testing.T) {
+	// interrupt runs a transaction up to state, as if the process was killed after recording it.
+	interrupt := func(t *testing.T, state string) (string, *journal) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "savvy")
+		source := filepath.Join(dir, "savvy.new")
+		writeFile(t, target, "old")
+		writeFile(t, source, "new")
+
+		j := NewTransaction(target, Item{Source: source, Target: target}).journal
+		assert.NoError(t, j.prepare())
+		if state != statePrepared {
+			assert.NoError(t, os.Rename(source, target))
+		}
+		j.State = state
+		assert.NoError(t, j.write())
+		return dir, j
+	}
+
+	t.Run("NoTransaction", func(t *testing.T) {
+		assert.NoError(t, Recover(filepath.Join(t.TempDir(), "savvy")))
+	})
+	t.Run("Prepared", func(t *testing.T) {
+		dir, _ := interrupt(t, statePrepared)
+		assert.NoError(t, Recover(filepath.Join(dir, "savvy")))
+		assert.Equal(t, "old", readFile(t, filepath.Join(dir, "savvy")))
+		assertOnly(t, dir, "savvy", "savvy.new")
+	})
+	t.Run("Swapping", func(t *testing.T) {
+		dir, _ := interrupt(t, stateSwapping)
+		assert.NoError(t, Recover(filepath.Join(dir, "savvy")))
+		assert.Equal(t, "old", readFile(t, filepath.Join(dir, "savvy")))
+		assertOnly(t, dir, "savvy")
+	})
+	t.Run("SwappingBeforeReplace", func(t *testing.T) {
+		// the backup is a hard link to the target, which wasn't replaced yet.
+		dir, j := interrupt(t, statePrepared)
+		j.State = stateSwapping
+		assert.NoError(t, j.write())
+		assert.NoError(t, Recover(filepath.Join(dir, "savvy")))
+		assert.Equal(t, "old", readFile(t, filepath.Join(dir, "savvy")))
+		assertOnly(t, dir, "savvy", "savvy.new")
+	})
+	t.Run("Applied", func(t *testing.T) {
+		dir, _ := interrupt(t, stateApplied)
+		assert.NoError(t, Recover(filepath.Join(dir, "savvy")))
+		assert.Equal(t, "new", readFile(t, filepath.Join(dir, "savvy")))
+		assertOnly(t, dir, "savvy")
+	})
+	t.Run("Uncommitted", func(t *testing.T) {
+		dir, _ := interrupt(t, stateUncommitted)
+		assert.NoError(t, Recover(filepath.Join(dir, "savvy")))
+		assert.Equal(t, "old", readFile(t, filepath.Join(dir, "savvy")))
+		assertOnly(t, dir, "savvy")
+	})
+	t.Run("Restored", func(t *testing.T) {
+		// the targets were restored, but the process was killed before removing the backups.
+		dir, j := interrupt(t, stateSwapping)
+		assert.NoError(t, restore(j.Items[0].Backup, j.Items[0].Target, j.anchor))
+		j.State = stateRestored
+		assert.NoError(t, j.write())
+		assert.NoError(t, Recover(filepath.Join(dir, "savvy")))
+		assert.Equal(t, "old", readFile(t, filepath.Join(dir, "savvy")))
+		assertOnly(t, dir, "savvy")
+	})
+	t.Run("RetryRestore", func(t *testing.T) {
+		// the target was restored, but the process was killed before recording it.
+		dir, j := interrupt(t, stateSwapping)
+		assert.NoError(t, restore(j.Items[0].Backup, j.Items[0].Target, j.anchor))
+		assert.NoError(t, Recover(filepath.Join(dir, "savvy")))
+		assert.Equal(t, "old", readFile(t, filepath.Join(dir, "savvy")))
+		assertOnly(t, dir, "savvy")
+	})
+	t.Run("CorruptJournal", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "savvy")
+		writeFile(t, journalPath(target), "{")
+		assert.Error(t, Recover(target))
+	})
+}
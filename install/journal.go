@@ -0,0 +1,96 @@
+package install
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Transaction states, in the order they are recorded.
+const (
+	// statePrepared means every target was backed up, but none was replaced.
+	statePrepared = "prepared"
+	// stateSwapping means some targets may have been replaced.
+	stateSwapping = "swapping"
+	// stateApplied means every target was replaced.
+	stateApplied = "applied"
+	// stateUncommitted means every target was replaced, but the transaction must be rolled back
+	// unless it is committed, see Transaction.RollbackUnlessCommitted.
+	stateUncommitted = "uncommitted"
+	// stateRestored means every target was restored, but the backups may not have been removed.
+	stateRestored = "restored"
+)
+
+type journalItem struct {
+	Source    string      `json:"source"`
+	Target    string      `json:"target"`
+	Backup    string      `json:"backup"`
+	HasBackup bool        `json:"has_backup"`
+	Mode      os.FileMode `json:"mode,omitempty"`
+	// Staged is set if Source was staged next to Target by the transaction, and must be removed by it.
+	Staged bool `json:"staged"`
+}
+
+// journal records the progress of a Transaction on disk.
+type journal struct {
+	State string        `json:"state"`
+	Items []journalItem `json:"items"`
+
+	path string
+	// anchor is the path the transaction's journal and temporary files are named after, e.g the executable.
+	anchor string
+}
+
+// journalPath returns the path of the journal for a transaction anchored at anchor.
+func journalPath(anchor string) string {
+	return filepath.Join(filepath.Dir(anchor), "."+filepath.Base(anchor)+".upgrade-journal")
+}
+
+func readJournal(path string) (*journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &journal{path: path}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("failed to parse journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// write durably replaces the journal on disk.
+func (j *journal) write() error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return syncDir(filepath.Dir(j.path))
+}
+
+func (j *journal) remove() error {
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return syncDir(filepath.Dir(j.path))
+}
@@ -0,0 +1,255 @@
+package install
+
+import (
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Method describes how an executable was installed.
+type Method string
+
+const (
+	// Standalone executables were installed by downloading a release, and can be replaced.
+	Standalone Method = "standalone"
+	Homebrew   Method = "homebrew"
+	Nix        Method = "nix"
+	Snap       Method = "snap"
+	Dpkg       Method = "dpkg"
+	RPM        Method = "rpm"
+	GoInstall  Method = "go install"
+)
+
+// ErrManagedInstall means the executable is managed by a package manager and must be upgraded with it.
+var ErrManagedInstall = errors.New("executable is managed by a package manager")
+
+// ManagedInstallError describes an executable that is managed by a package manager.
+type ManagedInstallError struct {
+	// Err is ErrManagedInstall.
+	Err error
+	Installation
+}
+
+func (e *ManagedInstallError) Error() string {
+	return fmt.Sprintf("%s: %s was installed with %s, upgrade it with `%s`", e.Err, e.Path, e.Method, e.Command)
+}
+
+func (e *ManagedInstallError) Unwrap() error {
+	return e.Err
+}
+
+// Installation describes how an executable was installed.
+type Installation struct {
+	// Path is the executable path with all symlinks resolved. It is the file that is replaced on upgrade.
+	Path   string
+	Method Method
+	// Package is the name of the package the executable belongs to, if it is managed by a package manager.
+	Package string
+	// Command is the command that upgrades the package.
+	Command string
+}
+
+// IsManaged reports whether the executable is managed by a package manager.
+func (i *Installation) IsManaged() bool {
+	return i.Method != Standalone
+}
+
+// Err returns a *ManagedInstallError if the executable is managed by a package manager.
+func (i *Installation) Err() error {
+	if !i.IsManaged() {
+		return nil
+	}
+	return &ManagedInstallError{Err: ErrManagedInstall, Installation: *i}
+}
+
+// ResolvePath returns path with all symlinks resolved, or path if it can't be resolved.
+func ResolvePath(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	if abs, err := filepath.Abs(resolved); err == nil {
+		return abs
+	}
+	return resolved
+}
+
+// detector detects install methods. Its fields query the package managers' state.
+type detector struct {
+	// dpkgQuery returns the dpkg package that owns path.
+	dpkgQuery func(ctx context.Context, path string) (string, bool)
+	// rpmQuery returns the rpm package that owns path.
+	rpmQuery func(ctx context.Context, path string) (string, bool)
+	gobin    string
+	// readBuildInfo returns the Go build info of the executable at path.
+	readBuildInfo func(path string) (*buildinfo.BuildInfo, error)
+}
+
+func newDetector() *detector {
+	return &detector{
+		dpkgQuery:     dpkgQuery,
+		rpmQuery:      rpmQuery,
+		gobin:         gobin(),
+		readBuildInfo: buildinfo.ReadFile,
+	}
+}
+
+// Detect resolves the symlinks in path and returns how the executable was installed.
+//
+// Homebrew (including Linuxbrew), Nix, snap, dpkg, rpm and `go install` are detected. Any
+// other executable is Standalone.
+func Detect(ctx context.Context, path string) (*Installation, error) {
+	return newDetector().detect(ctx, path)
+}
+
+var (
+	// homebrewPath matches executables in a Homebrew Cellar or Caskroom, in any prefix.
+	homebrewPath = regexp.MustCompile(`/(Cellar|Caskroom)/([^/]+)/`)
+	// nixStorePath matches a Nix store path, capturing the package name without its version.
+	nixStorePath = regexp.MustCompile(`^/nix/store/[0-9a-z]{32}-([^/]+?)(-[0-9][^/]*)?/`)
+	// snapPath matches executables in a mounted snap.
+	snapPath = regexp.MustCompile(`^/snap/([^/]+)/`)
+)
+
+func (d *detector) detect(ctx context.Context, path string) (*Installation, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	return d.classify(ctx, abs, resolved), nil
+}
+
+// classify returns how the executable at abs, which resolves to resolved, was installed.
+func (d *detector) classify(ctx context.Context, abs, resolved string) *Installation {
+	inst := &Installation{Path: resolved, Method: Standalone}
+
+	switch {
+	case homebrewPath.MatchString(resolved):
+		m := homebrewPath.FindStringSubmatch(resolved)
+		inst.Method, inst.Package, inst.Command = Homebrew, m[2], "brew upgrade "+m[2]
+		if m[1] == "Caskroom" {
+			inst.Command = "brew upgrade --cask " + m[2]
+		}
+	case nixStorePath.MatchString(resolved):
+		name := nixStorePath.FindStringSubmatch(resolved)[1]
+		inst.Method, inst.Package, inst.Command = Nix, name, "nix profile upgrade "+name
+	case strings.HasPrefix(abs, "/snap/bin/"):
+		// snap commands are symlinks to /usr/bin/snap, which runs the snap named after the link.
+		name, _, _ := strings.Cut(filepath.Base(abs), ".")
+		inst.Method, inst.Package, inst.Command = Snap, name, "sudo snap refresh "+name
+	case snapPath.MatchString(resolved):
+		name := snapPath.FindStringSubmatch(resolved)[1]
+		inst.Method, inst.Package, inst.Command = Snap, name, "sudo snap refresh "+name
+	default:
+		if pkg, ok := d.dpkgOwner(ctx, abs, resolved); ok {
+			inst.Method, inst.Package, inst.Command = Dpkg, pkg, "sudo apt-get install --only-upgrade "+pkg
+		} else if pkg, ok := d.rpmQuery(ctx, resolved); ok {
+			inst.Method, inst.Package, inst.Command = RPM, pkg, "sudo dnf upgrade "+pkg
+		} else if module, ok := d.goInstalled(resolved); ok {
+			inst.Method, inst.Package, inst.Command = GoInstall, module, "go install "+module+"@latest"
+		}
+	}
+	return inst
+}
+
+// dpkgOwner returns the dpkg package that owns the first of paths that belongs to one.
+func (d *detector) dpkgOwner(ctx context.Context, paths ...string) (string, bool) {
+	for _, path := range paths {
+		if pkg, ok := d.dpkgQuery(ctx, path); ok {
+			return pkg, true
+		}
+	}
+	return "", false
+}
+
+// goInstalled reports whether the executable at path was installed with `go install module@version`,
+// and returns its module.
+//
+// Executables built from a checkout, e.g by goreleaser, and copied to GOBIN are not: only builds
+// from the module cache record the main module's checksum.
+func (d *detector) goInstalled(path string) (string, bool) {
+	if d.gobin == "" || filepath.Dir(path) != filepath.Clean(d.gobin) {
+		return "", false
+	}
+	info, err := d.readBuildInfo(path)
+	if err != nil || info.Main.Sum == "" || info.Path == "" {
+		return "", false
+	}
+	return info.Path, true
+}
+
+// dpkgQuery asks dpkg which package owns path, if dpkg is installed.
+func dpkgQuery(ctx context.Context, path string) (string, bool) {
+	// dpkg treats paths containing wildcards as patterns, which could match other files.
+	if strings.ContainsAny(path, `*?[]\`) {
+		return "", false
+	}
+	dpkg, err := exec.LookPath("dpkg-query")
+	if err != nil {
+		return "", false
+	}
+	out, err := exec.CommandContext(ctx, dpkg, "--search", path).Output()
+	if err != nil {
+		return "", false
+	}
+	return parseDpkgSearch(string(out), path)
+}
+
+// parseDpkgSearch returns the package owning path in the output of `dpkg-query --search`, e.g
+// "savvy:amd64: /usr/bin/savvy". Diversions are listed too, and are skipped.
+func parseDpkgSearch(out, path string) (string, bool) {
+	for _, line := range strings.Split(out, "\n") {
+		packages, file, ok := strings.Cut(line, ": ")
+		if !ok || file != path || strings.HasPrefix(packages, "diversion by") {
+			continue
+		}
+		// files shared by several packages are listed as "pkg1, pkg2: path".
+		pkg, _, _ := strings.Cut(packages, ", ")
+		pkg, _, _ = strings.Cut(pkg, ":")
+		if pkg = strings.TrimSpace(pkg); pkg != "" {
+			return pkg, true
+		}
+	}
+	return "", false
+}
+
+// rpmQuery asks rpm which package owns path, if rpm is installed.
+func rpmQuery(ctx context.Context, path string) (string, bool) {
+	rpm, err := exec.LookPath("rpm")
+	if err != nil {
+		return "", false
+	}
+	out, err := exec.CommandContext(ctx, rpm, "-qf", "--queryformat", "%{NAME}", path).Output()
+	if err != nil {
+		return "", false
+	}
+	name := strings.TrimSpace(string(out))
+	return name, name != ""
+}
+
+// gobin returns the directory `go install` installs executables to.
+func gobin() string {
+	if dir := os.Getenv("GOBIN"); dir != "" {
+		return dir
+	}
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		return filepath.Join(home, "go", "bin")
+	}
+	// only the first GOPATH entry is used by `go install`.
+	return filepath.Join(filepath.SplitList(gopath)[0], "bin")
+}
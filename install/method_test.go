@@ -0,0 +1,178 @@
+package install
+
+import (
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	ctx := context.Background()
+	d := &detector{
+		dpkgQuery: func(ctx context.Context, path string) (string, bool) {
+			return "savvy", path == "/usr/bin/savvy"
+		},
+		rpmQuery: func(ctx context.Context, path string) (string, bool) {
+			return "savvy-cli", path == "/usr/local/bin/savvy-rpm"
+		},
+		gobin: "/home/user/go/bin",
+		readBuildInfo: func(path string) (*buildinfo.BuildInfo, error) {
+			info := &buildinfo.BuildInfo{Path: "github.com/getsavvyinc/savvy-cli"}
+			switch filepath.Base(path) {
+			case "savvy":
+				info.Main.Sum = "h1:0c5sxjsxq5yqb2bhmj1jpbqrxm0fpnb3="
+			case "savvy-checkout":
+				// built from a checkout and copied to GOBIN
+			default:
+				return nil, errors.New("not a go binary")
+			}
+			return info, nil
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		abs      string
+		resolved string
+		want     Installation
+	}{
+		{
+			name:     "Standalone",
+			abs:      "/usr/local/bin/savvy",
+			resolved: "/usr/local/bin/savvy",
+			want:     Installation{Path: "/usr/local/bin/savvy", Method: Standalone},
+		},
+		{
+			name:     "Homebrew",
+			abs:      "/opt/homebrew/bin/savvy",
+			resolved: "/opt/homebrew/Cellar/savvy/0.1.0/bin/savvy",
+			want:     Installation{Path: "/opt/homebrew/Cellar/savvy/0.1.0/bin/savvy", Method: Homebrew, Package: "savvy", Command: "brew upgrade savvy"},
+		},
+		{
+			name:     "Linuxbrew",
+			abs:      "/home/linuxbrew/.linuxbrew/bin/savvy",
+			resolved: "/home/linuxbrew/.linuxbrew/Cellar/savvy-cli/0.1.0/bin/savvy",
+			want:     Installation{Path: "/home/linuxbrew/.linuxbrew/Cellar/savvy-cli/0.1.0/bin/savvy", Method: Homebrew, Package: "savvy-cli", Command: "brew upgrade savvy-cli"},
+		},
+		{
+			name:     "HomebrewCask",
+			abs:      "/usr/local/bin/savvy",
+			resolved: "/usr/local/Caskroom/savvy/0.1.0/savvy",
+			want:     Installation{Path: "/usr/local/Caskroom/savvy/0.1.0/savvy", Method: Homebrew, Package: "savvy", Command: "brew upgrade --cask savvy"},
+		},
+		{
+			name:     "Nix",
+			abs:      "/home/user/.nix-profile/bin/savvy",
+			resolved: "/nix/store/0c5sxjsxq5yqb2bhmj1jpbqrxm0fpnb3-savvy-cli-0.1.0/bin/savvy",
+			want:     Installation{Path: "/nix/store/0c5sxjsxq5yqb2bhmj1jpbqrxm0fpnb3-savvy-cli-0.1.0/bin/savvy", Method: Nix, Package: "savvy-cli", Command: "nix profile upgrade savvy-cli"},
+		},
+		{
+			name:     "SnapCommand",
+			abs:      "/snap/bin/savvy",
+			resolved: "/usr/bin/snap",
+			want:     Installation{Path: "/usr/bin/snap", Method: Snap, Package: "savvy", Command: "sudo snap refresh savvy"},
+		},
+		{
+			name:     "Snap",
+			abs:      "/snap/savvy/42/bin/savvy",
+			resolved: "/snap/savvy/42/bin/savvy",
+			want:     Installation{Path: "/snap/savvy/42/bin/savvy", Method: Snap, Package: "savvy", Command: "sudo snap refresh savvy"},
+		},
+		{
+			name:     "Dpkg",
+			abs:      "/bin/savvy",
+			resolved: "/usr/bin/savvy",
+			want:     Installation{Path: "/usr/bin/savvy", Method: Dpkg, Package: "savvy", Command: "sudo apt-get install --only-upgrade savvy"},
+		},
+		{
+			name:     "RPM",
+			abs:      "/usr/local/bin/savvy-rpm",
+			resolved: "/usr/local/bin/savvy-rpm",
+			want:     Installation{Path: "/usr/local/bin/savvy-rpm", Method: RPM, Package: "savvy-cli", Command: "sudo dnf upgrade savvy-cli"},
+		},
+		{
+			name:     "GoInstall",
+			abs:      "/home/user/go/bin/savvy",
+			resolved: "/home/user/go/bin/savvy",
+			want:     Installation{Path: "/home/user/go/bin/savvy", Method: GoInstall, Package: "github.com/getsavvyinc/savvy-cli", Command: "go install github.com/getsavvyinc/savvy-cli@latest"},
+		},
+		{
+			name:     "GoBinBuiltFromCheckout",
+			abs:      "/home/user/go/bin/savvy-checkout",
+			resolved: "/home/user/go/bin/savvy-checkout",
+			want:     Installation{Path: "/home/user/go/bin/savvy-checkout", Method: Standalone},
+		},
+		{
+			name:     "GoBinNotAGoBinary",
+			abs:      "/home/user/go/bin/savvy-script",
+			resolved: "/home/user/go/bin/savvy-script",
+			want:     Installation{Path: "/home/user/go/bin/savvy-script", Method: Standalone},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inst := d.classify(ctx, tc.abs, tc.resolved)
+			assert.Equal(t, tc.want, *inst)
+			if tc.want.Method == Standalone {
+				assert.NoError(t, inst.Err())
+				return
+			}
+			err := inst.Err()
+			assert.ErrorIs(t, err, ErrManagedInstall)
+			var merr *ManagedInstallError
+			if assert.ErrorAs(t, err, &merr) {
+				assert.Equal(t, tc.want.Command, merr.Command)
+			}
+		})
+	}
+
+	t.Run("ResolveSymlinks", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("creating symlinks requires privileges on windows")
+		}
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		assert.NoError(t, err)
+		target := filepath.Join(dir, "savvy-0.1.0")
+		link := filepath.Join(dir, "savvy")
+		writeFile(t, target, "binary")
+		assert.NoError(t, os.Symlink("savvy-0.1.0", link))
+
+		inst, err := d.detect(ctx, link)
+		assert.NoError(t, err)
+		assert.Equal(t, &Installation{Path: target, Method: Standalone}, inst)
+		assert.Equal(t, target, ResolvePath(link))
+	})
+}
+
+func TestParseDpkgSearch(t *testing.T) {
+	testCases := []struct {
+		name   string
+		out    string
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{name: "Owned", out: "savvy: /usr/bin/savvy\n", path: "/usr/bin/savvy", want: "savvy", wantOK: true},
+		{name: "MultiArch", out: "savvy:amd64: /usr/bin/savvy\n", path: "/usr/bin/savvy", want: "savvy", wantOK: true},
+		{name: "Shared", out: "savvy-common, savvy: /usr/bin/savvy\n", path: "/usr/bin/savvy", want: "savvy-common", wantOK: true},
+		{
+			name: "Diverted",
+			out:  "diversion by savvy-wrapper from: /usr/bin/savvy\ndiversion by savvy-wrapper to: /usr/bin/savvy.real\nsavvy-wrapper: /usr/bin/savvy\n",
+			path: "/usr/bin/savvy", want: "savvy-wrapper", wantOK: true,
+		},
+		{name: "OtherPath", out: "savvy: /usr/bin/savvy-helper\n", path: "/usr/bin/savvy"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pkg, ok := parseDpkgSearch(tc.out, tc.path)
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.want, pkg)
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package install
+
+import "os"
+
+// copyOwner is not implemented on this platform; the new file is owned by the user running the upgrade.
+func copyOwner(info os.FileInfo, path string) error {
+	return nil
+}
+
+// owner is not implemented on this platform.
+func owner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
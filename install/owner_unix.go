@@ -0,0 +1,33 @@
+//go:build unix
+
+package install
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// copyOwner changes the owner and group of the file at path to those in info.
+//
+// The owner is left unchanged if the process isn't permitted to change it.
+func copyOwner(info os.FileInfo, path string) error {
+	uid, gid, ok := owner(info)
+	if !ok {
+		return nil
+	}
+	err := os.Chown(path, uid, gid)
+	if errors.Is(err, os.ErrPermission) {
+		return nil
+	}
+	return err
+}
+
+// owner returns the user and group ids of the file described by info.
+func owner(info os.FileInfo) (int, int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
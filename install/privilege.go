@@ -0,0 +1,116 @@
+package install
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+)
+
+var (
+	// ErrPermissionDenied means the current user can't replace the executable.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrNoEscalator means neither sudo nor doas is installed.
+	ErrNoEscalator = errors.New("no privilege escalation command found")
+)
+
+// PermissionError describes an executable the current user can't replace.
+type PermissionError struct {
+	// Err is ErrPermissionDenied.
+	Err error
+	// Path is the executable that can't be replaced.
+	Path string
+	// Cause is the error returned by the filesystem.
+	Cause error
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("%s: can't replace %s: %s", e.Err, e.Path, e.Cause)
+}
+
+func (e *PermissionError) Unwrap() error {
+	return e.Err
+}
+
+// CheckWritable returns a *PermissionError if the current user can't replace the file at path.
+func CheckWritable(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), TempPattern(path))
+	if errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EROFS) {
+		return &PermissionError{Err: ErrPermissionDenied, Path: path, Cause: err}
+	}
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// Escalators are the commands FindEscalator looks for, in order of preference.
+var Escalators = []string{"sudo", "doas"}
+
+// FindEscalator returns the path of the first of Escalators that is installed.
+func FindEscalator() (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", fmt.Errorf("%w: privilege escalation isn't supported on windows", ErrNoEscalator)
+	}
+	for _, name := range Escalators {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", ErrNoEscalator
+}
+
+// privilegedInstallScript copies the verified file next to the target and renames it over the target, so
+// that the target is replaced atomically even if the file is on another filesystem.
+const privilegedInstallScript = `install -m "$1" -o "$2" -g "$3" "$4" "$5" && mv -f "$5" "$6" || { rm -f "$5"; exit 1; }`
+
+// ReplacePrivileged installs item by running the install step through escalator, e.g sudo.
+//
+// Only `install` and `mv` run with elevated privileges; the source must already be verified. The new
+// file keeps the mode, unless item.Mode is set, and ownership of the file it replaces, but not its
+// extended attributes. New files are owned by root. The escalator may prompt for a password on the terminal.
+func ReplacePrivileged(ctx context.Context, escalator string, item Item) error {
+	mode, uid, gid := os.FileMode(0755), 0, 0
+	if info, err := os.Stat(item.Source); err == nil {
+		mode = info.Mode()
+	}
+	if info, err := os.Stat(item.Target); err == nil {
+		mode = info.Mode()
+		if u, g, ok := owner(info); ok {
+			uid, gid = u, g
+		}
+	}
+	if item.Mode != 0 {
+		mode = item.Mode
+	}
+	tmp := filepath.Join(filepath.Dir(item.Target), tempPrefix(item.Target)+"privileged"+tempSuffix)
+
+	cmd := exec.CommandContext(ctx, escalator, "sh", "-c", privilegedInstallScript, "sh",
+		unixMode(mode), strconv.Itoa(uid), strconv.Itoa(gid), item.Source, tmp, item.Target)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to install %s with %s: %w", item.Target, filepath.Base(escalator), err)
+	}
+	return nil
+}
+
+// unixMode formats mode as the octal mode accepted by chmod and install.
+func unixMode(mode os.FileMode) string {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 0o1000
+	}
+	return fmt.Sprintf("%04o", m)
+}
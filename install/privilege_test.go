@@ -0,0 +1,76 @@
+package install
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "savvy")
+	writeFile(t, target, "old")
+	assert.NoError(t, CheckWritable(target))
+	assertOnly(t, dir, "savvy")
+
+	if runtime.GOOS == "windows" || os.Getuid() == 0 {
+		t.Skip("directory permissions can't be enforced")
+	}
+	assert.NoError(t, os.Chmod(dir, 0555))
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+
+	err := CheckWritable(target)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	var perr *PermissionError
+	if assert.ErrorAs(t, err, &perr) {
+		assert.Equal(t, target, perr.Path)
+	}
+}
+
+func TestReplacePrivileged(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("privilege escalation isn't supported on windows")
+	}
+	// env runs the install step without escalating, as the current user.
+	escalator, err := exec.LookPath("env")
+	if err != nil {
+		t.Skip("env not found")
+	}
+	ctx := context.Background()
+
+	t.Run("ReplaceExisting", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "savvy")
+		source := filepath.Join(t.TempDir(), "savvy.new")
+		writeFile(t, target, "old")
+		writeFile(t, source, "new")
+		assert.NoError(t, os.Chmod(target, 0750))
+
+		assert.NoError(t, ReplacePrivileged(ctx, escalator, Item{Source: source, Target: target}))
+		assert.Equal(t, "new", readFile(t, target))
+		info, err := os.Stat(target)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+		assertOnly(t, dir, "savvy")
+	})
+	t.Run("MissingSource", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "savvy")
+		writeFile(t, target, "old")
+
+		assert.Error(t, ReplacePrivileged(ctx, escalator, Item{Source: filepath.Join(dir, "missing"), Target: target}))
+		assert.Equal(t, "old", readFile(t, target))
+		assertOnly(t, dir, "savvy")
+	})
+}
+
+func TestUnixMode(t *testing.T) {
+	assert.Equal(t, "0755", unixMode(0755))
+	assert.Equal(t, "4750", unixMode(0750|os.ModeSetuid))
+	assert.Equal(t, "2755", unixMode(0755|os.ModeSetgid))
+}
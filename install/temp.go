@@ -0,0 +1,63 @@
+package install
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tempSuffix ends the name of every temporary file created during an upgrade.
+const tempSuffix = ".tmp"
+
+// DefaultStaleAge is how old a temporary file must be before Sweep considers it orphaned.
+const DefaultStaleAge = time.Hour
+
+// tempPrefix starts the name of every temporary file created during an upgrade of executable.
+func tempPrefix(executable string) string {
+	return "." + filepath.Base(executable) + ".upgrade-"
+}
+
+// TempPattern returns the os.CreateTemp pattern for temporary files created during an upgrade of executable,
+// e.g .savvy.upgrade-123456.tmp.
+//
+// Files named after the pattern are removed by Sweep once they are stale.
+func TempPattern(executable string) string {
+	return tempPrefix(executable) + "*" + tempSuffix
+}
+
+// Sweep removes temporary files of upgrades of executable from dirs that were last modified more than
+// olderThan ago, e.g because the upgrade was killed before it could remove them.
+//
+// Callers should hold the upgrade lock so that the files of an upgrade in progress are never removed.
+func Sweep(executable string, dirs []string, olderThan time.Duration) error {
+	prefix := tempPrefix(executable)
+	cutoff := time.Now().Add(-olderThan)
+
+	var errs []error
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.Type().IsRegular() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, tempSuffix) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || info.ModTime().After(cutoff) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
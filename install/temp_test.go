@@ -0,0 +1,44 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSweep(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * DefaultStaleAge)
+	for _, name := range []string{
+		"savvy",
+		".savvy.upgrade-123.tmp",
+		".savvy.upgrade-456.tmp",
+		".other.upgrade-123.tmp",
+		".savvy.upgrade-journal",
+		".savvy.upgrade-backup",
+		"savvy.bak",
+	} {
+		writeFile(t, filepath.Join(dir, name), "data")
+		assert.NoError(t, os.Chtimes(filepath.Join(dir, name), old, old))
+	}
+	// a recent temp file may belong to an upgrade in progress.
+	writeFile(t, filepath.Join(dir, ".savvy.upgrade-789.tmp"), "data")
+
+	assert.NoError(t, Sweep(filepath.Join(dir, "savvy"), []string{dir, filepath.Join(dir, "missing")}, DefaultStaleAge))
+	assertOnly(t, dir, "savvy", ".savvy.upgrade-789.tmp", ".other.upgrade-123.tmp", ".savvy.upgrade-journal", ".savvy.upgrade-backup", "savvy.bak")
+}
+
+func TestTempPattern(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.CreateTemp(dir, TempPattern(filepath.Join(dir, "savvy")))
+	assert.NoError(t, err)
+	f.Close()
+	old := time.Now().Add(-2 * DefaultStaleAge)
+	assert.NoError(t, os.Chtimes(f.Name(), old, old))
+
+	assert.NoError(t, Sweep("savvy", []string{dir}, DefaultStaleAge))
+	assert.NoFileExists(t, f.Name())
+}
@@ -0,0 +1,67 @@
+package install
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// capabilityXattr holds the file capabilities of an executable, e.g cap_net_bind_service.
+const capabilityXattr = "security.capability"
+
+// copyXattrs copies the extended attributes of the file at from to the file at to.
+//
+// File capabilities must be copied, since the binary may not work without them. Other attributes,
+// e.g SELinux labels that the process isn't permitted to set, are copied on a best effort basis.
+func copyXattrs(from, to string) error {
+	names, err := listXattrs(from)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		value, err := getXattr(from, name)
+		if err != nil {
+			return err
+		}
+		if err := syscall.Setxattr(to, name, value, 0); err != nil && name == capabilityXattr {
+			return fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func listXattrs(path string) ([]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package install
+
+// copyXattrs is not implemented on this platform; extended attributes are not copied to the new file.
+func copyXattrs(from, to string) error {
+	return nil
+}
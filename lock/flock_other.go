@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package lock
+
+import "os"
+
+// tryLock is not implemented on this platform; concurrent upgrades aren't prevented.
+func tryLock(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0644)
+}
+
+// isReadOnly reports whether err means the lock file is on a read-only filesystem.
+func isReadOnly(err error) bool {
+	return false
+}
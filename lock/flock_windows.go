@@ -0,0 +1,32 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation is ERROR_SHARING_VIOLATION, which CreateFile returns if another process has the file open.
+const errorSharingViolation syscall.Errno = 32
+
+// tryLock opens the file at path without sharing it, creating it if needed.
+func tryLock(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if errors.Is(err, errorSharingViolation) {
+		return nil, errLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
+
+// isReadOnly reports whether err means the lock file is on a read-only filesystem. Windows reports
+// read-only media as access denied, which is a permission error.
+func isReadOnly(err error) bool {
+	return false
+}
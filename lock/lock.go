@@ -0,0 +1,104 @@
+// Package lock prevents concurrent upgrades of the same executable.
+package lock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrUpgradeInProgress means another process is upgrading the executable.
+var ErrUpgradeInProgress = errors.New("upgrade already in progress")
+
+// errLocked is returned by tryLock if another process holds the lock.
+var errLocked = errors.New("locked")
+
+// pollInterval is how often Acquire retries while waiting for the lock.
+const pollInterval = 100 * time.Millisecond
+
+// Lock is an advisory inter-process lock on an executable.
+//
+// The lock is released when the process exits, so a crashed upgrade never leaves it held.
+type Lock struct {
+	file *os.File
+}
+
+// Path returns the path of the lock file for the executable at executablePath, e.g .savvy.upgrade-lock
+// next to it.
+//
+// Only users who can replace the executable can create the lock file, so it can't be held by
+// anyone else. The lock file is never removed, since removing it would let two processes lock
+// different files.
+func Path(executablePath string) string {
+	if abs, err := filepath.Abs(executablePath); err == nil {
+		executablePath = abs
+	}
+	return filepath.Join(filepath.Dir(executablePath), "."+filepath.Base(executablePath)+".upgrade-lock")
+}
+
+// fallbackPath returns the path of the lock file in the user's cache directory, for executables
+// whose directory the user can't write to, e.g when the install step escalates privileges.
+func fallbackPath(executablePath string) (string, error) {
+	if abs, err := filepath.Abs(executablePath); err == nil {
+		executablePath = abs
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "upgrade-cli")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(executablePath))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".lock"), nil
+}
+
+// Acquire locks the executable at executablePath, waiting up to timeout for another process to release it.
+//
+// The lock file is created next to the executable, see Path. If the user can't create it there,
+// a lock file in the user's cache directory is used instead, which only serializes upgrades by
+// the same user.
+//
+// A timeout of zero doesn't wait. It returns an error wrapping ErrUpgradeInProgress if the lock is held.
+func Acquire(ctx context.Context, executablePath string, timeout time.Duration) (*Lock, error) {
+	path := Path(executablePath)
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := tryLock(path)
+		if errors.Is(err, fs.ErrPermission) || isReadOnly(err) {
+			fallback, ferr := fallbackPath(executablePath)
+			if ferr != nil {
+				return nil, fmt.Errorf("failed to lock %s: %w", path, errors.Join(err, ferr))
+			}
+			path = fallback
+			f, err = tryLock(path)
+		}
+		if err == nil {
+			return &Lock{file: f}, nil
+		}
+		if !errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: %s is being upgraded by another process", ErrUpgradeInProgress, executablePath)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrUpgradeInProgress, ctx.Err())
+		case <-time.After(min(pollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+// Release releases the lock.
+func (l *Lock) Release() error {
+	return l.file.Close()
+}
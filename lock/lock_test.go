@@ -0,0 +1,89 @@
+package lock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquire(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		t.Skip("locking isn't tested on this platform")
+	}
+	ctx := context.Background()
+	executablePath := filepath.Join(t.TempDir(), "savvy")
+
+	l, err := Acquire(ctx, executablePath, 0)
+	assert.NoError(t, err)
+
+	t.Run("HeldByAnother", func(t *testing.T) {
+		other, err := Acquire(ctx, executablePath, 0)
+		assert.ErrorIs(t, err, ErrUpgradeInProgress)
+		assert.Nil(t, other)
+	})
+	t.Run("OtherExecutable", func(t *testing.T) {
+		other, err := Acquire(ctx, executablePath+"-other", 0)
+		assert.NoError(t, err)
+		if assert.NotNil(t, other) {
+			assert.NoError(t, other.Release())
+		}
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		start := time.Now()
+		_, err := Acquire(ctx, executablePath, 300*time.Millisecond)
+		assert.ErrorIs(t, err, ErrUpgradeInProgress)
+		assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	})
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := Acquire(ctx, executablePath, time.Minute)
+		assert.ErrorIs(t, err, ErrUpgradeInProgress)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+	t.Run("WaitForRelease", func(t *testing.T) {
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			l.Release()
+		}()
+		l, err := Acquire(ctx, executablePath, 5*time.Second)
+		assert.NoError(t, err)
+		if assert.NotNil(t, l) {
+			assert.NoError(t, l.Release())
+		}
+	})
+}
+
+func TestPath(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, filepath.Join(dir, ".savvy.upgrade-lock"), Path(filepath.Join(dir, "savvy")))
+}
+
+func TestAcquireFallback(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("directory permissions aren't tested on this platform")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to any directory")
+	}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	assert.NoError(t, os.Chmod(dir, 0555))
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+	executablePath := filepath.Join(dir, "savvy")
+
+	l, err := Acquire(context.Background(), executablePath, 0)
+	assert.NoError(t, err)
+	if assert.NotNil(t, l) {
+		assert.NoFileExists(t, Path(executablePath))
+		_, err := Acquire(context.Background(), executablePath, 0)
+		assert.ErrorIs(t, err, ErrUpgradeInProgress)
+		assert.NoError(t, l.Release())
+	}
+}
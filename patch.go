@@ -0,0 +1,112 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/getsavvyinc/upgrade-cli/archive"
+	"github.com/getsavvyinc/upgrade-cli/delta"
+	"github.com/getsavvyinc/upgrade-cli/install"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+)
+
+// errNoPatch means the release has no patch that applies to the installed binary.
+var errNoPatch = errors.New("no patch for the installed version")
+
+// WithoutPatches always downloads the full asset, even if the release has a patch for the current version.
+func WithoutPatches() Opt {
+	return func(u *upgrader) {
+		u.skipPatches = true
+	}
+}
+
+// downloadPatched builds the new binary by applying the release's patch for currentVersion, named
+// as delta.PatchName, to the binary at executablePath.
+//
+// The returned Info describes the patched binary as if it was the downloaded asset, so that it is
+// validated against the release's checksums like a full download. It returns an error wrapping
+// errNoPatch if the release has no such patch, or the asset isn't a single binary.
+func (u *upgrader) downloadPatched(ctx context.Context, currentVersion, executablePath string, releaseInfo *release.Info, downloader asset.Downloader) (*asset.Info, func() error, error) {
+	selector, ok := downloader.(asset.Selector)
+	fetcher, canFetch := downloader.(asset.Fetcher)
+	// archives, compressed assets and install plans can't be patched, since the installed files aren't the release asset.
+	if u.skipPatches || len(u.plan) > 0 || !ok || !canFetch {
+		return nil, nil, errNoPatch
+	}
+	target, ok := selector.SelectAsset(releaseInfo)
+	if !ok || archive.Format(target.Name) != "" || archive.Compression(target.Name) != "" {
+		return nil, nil, errNoPatch
+	}
+	name := delta.PatchName(target.Name, currentVersion)
+	var patchAsset *release.Asset
+	for i := range releaseInfo.Assets {
+		if releaseInfo.Assets[i].Name == name {
+			patchAsset = &releaseInfo.Assets[i]
+			break
+		}
+	}
+	if patchAsset == nil {
+		return nil, nil, fmt.Errorf("%w: %s", errNoPatch, name)
+	}
+
+	patchInfo, removePatch, err := fetcher.Fetch(ctx, *patchAsset)
+	if err != nil {
+		return nil, nil, err
+	}
+	if removePatch != nil {
+		defer removePatch()
+	}
+
+	path, err := applyPatch(executablePath, patchInfo.DownloadedBinaryFilePath, install.TempPattern(u.installPath))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to apply %s: %w", name, err)
+	}
+	cleanup := func() error {
+		return os.Remove(path)
+	}
+	info, err := asset.NewFileInfo(target, path)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return info, cleanup, nil
+}
+
+// applyPatch applies the patch at patchPath to the binary at executablePath, and returns the path
+// of the patched binary. It is created next to the patch, with a name matching pattern.
+func applyPatch(executablePath, patchPath, pattern string) (string, error) {
+	old, err := os.Open(executablePath)
+	if err != nil {
+		return "", err
+	}
+	defer old.Close()
+	patch, err := os.Open(patchPath)
+	if err != nil {
+		return "", err
+	}
+	defer patch.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(patchPath), pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := delta.Patch(old, patch, out); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := out.Chmod(0755); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
@@ -0,0 +1,108 @@
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/delta"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+	"github.com/getsavvyinc/upgrade-cli/verify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchedUpgrade(t *testing.T) {
+	ctx := context.Background()
+	old := bytes.Repeat([]byte("savvy 1.2.3 "), 1000)
+	new := append(bytes.Repeat([]byte("savvy 1.3.0 "), 1000), "completions"...)
+	var patch bytes.Buffer
+	assert.NoError(t, delta.Diff(old, new, &patch))
+	sum := sha256.Sum256(new)
+	errVerify := errors.New("smoke test failed")
+	// tooLarge claims to produce a file larger than delta.MaxSize.
+	tooLarge := binary.BigEndian.AppendUint64([]byte("UCDELTA1"), uint64(delta.MaxSize+1))
+	const patchName = "savvy_linux_amd64_from_1.2.3.patch"
+
+	tests := []struct {
+		name           string
+		installed      []byte
+		currentVersion string
+		opts           []Opt
+		// patch replaces the release's patch, and patchErr fails its download.
+		patch    []byte
+		patchErr error
+		wantErr  error
+		// wantDownloads are the full downloads, made when the executable can't be patched.
+		wantDownloads []string
+	}{
+		{name: "Patched", installed: old, currentVersion: "v1.2.3"},
+		{name: "ModifiedExecutable", installed: append([]byte("#!"), old...), currentVersion: "1.2.3", wantDownloads: []string{"savvy_linux_amd64"}},
+		{name: "NoPatchForVersion", installed: old, currentVersion: "1.2.2", wantDownloads: []string{"savvy_linux_amd64"}},
+		{
+			name:           "TruncatedPatch",
+			installed:      old,
+			currentVersion: "1.2.3",
+			patchErr:       asset.ErrTruncatedDownload,
+			wantDownloads:  []string{"savvy_linux_amd64"},
+		},
+		{name: "PatchTooLarge", installed: old, currentVersion: "1.2.3", patch: tooLarge, wantDownloads: []string{"savvy_linux_amd64"}},
+		{
+			name:           "Cancelled",
+			installed:      old,
+			currentVersion: "1.2.3",
+			patchErr:       context.Canceled,
+			wantErr:        context.Canceled,
+		},
+		{
+			// the full binary would fail the same verifier, so it isn't downloaded.
+			name:           "VerifierFails",
+			installed:      old,
+			currentVersion: "1.2.3",
+			opts: []Opt{WithVerifier(verifierFunc(func(ctx context.Context, c verify.Candidate) error {
+				return errVerify
+			}))},
+			wantErr: errVerify,
+		},
+		{name: "WithoutPatches", installed: old, currentVersion: "1.2.3", opts: []Opt{WithoutPatches()}, wantDownloads: []string{"savvy_linux_amd64"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &assetServer{dir: t.TempDir(), assets: map[string][]byte{
+				"savvy_linux_amd64": new,
+				patchName:           patch.Bytes(),
+			}, errs: map[string]error{patchName: tc.patchErr}}
+			if tc.patch != nil {
+				server.assets[patchName] = tc.patch
+			}
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			executable, u := newTestUpgrader(t, string(tc.installed), append([]Opt{
+				WithAssetDownloader(server),
+				WithCheckSumValidator(digestValidator{want: hex.EncodeToString(sum[:])}),
+			}, tc.opts...)...)
+			u.releaseGetter = releaseFunc(func() *release.Info {
+				// the upgrade is cancelled while the patch is downloaded.
+				if errors.Is(tc.patchErr, context.Canceled) {
+					cancel()
+				}
+				return server.release("v1.3.0")
+			})
+
+			err := u.Upgrade(ctx, tc.currentVersion)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				assertContent(t, executable, string(tc.installed))
+			} else {
+				assert.NoError(t, err)
+				assertContent(t, executable, string(new))
+			}
+			assertOnlyExecutable(t, executable)
+			assert.Equal(t, tc.wantDownloads, server.downloads)
+		})
+	}
+}
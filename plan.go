@@ -0,0 +1,169 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/getsavvyinc/upgrade-cli/archive"
+	"github.com/getsavvyinc/upgrade-cli/install"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+)
+
+// Artifact is a file installed by an upgrade.
+//
+// An artifact is either a member of the downloaded archive, a release asset of its own, or, if
+// neither is set, the downloaded asset itself.
+type Artifact struct {
+	// Member is the path of the file in the downloaded archive, e.g "savvyd" or "completions/savvy.zsh".
+	// Archives may wrap their content in a directory, which doesn't need to be included.
+	Member string
+	// Asset is the name of the release asset to install, e.g "savvy.zsh". Its checksum is validated
+	// like the downloaded asset's.
+	Asset string
+	// Destination is the path the file is installed at. Relative paths are relative to the directory
+	// containing the executable. The directory must exist.
+	Destination string
+	// Mode is the permissions the file is installed with. It defaults to the permissions of the file
+	// it replaces, or the member's permissions in the archive.
+	Mode os.FileMode
+}
+
+var (
+	ErrNoPlanAsset = errors.New("release asset in install plan not found")
+	// ErrNoExecutableInPlan means no artifact in the install plan is installed at the executable path,
+	// so the verifiers couldn't check the new version.
+	ErrNoExecutableInPlan = errors.New("install plan doesn't install the executable")
+	// ErrPlanNotEscalatable means an install plan with several artifacts needs privilege escalation.
+	ErrPlanNotEscalatable = errors.New("install plans with several files can't be installed with privilege escalation")
+	// ErrNoExecutableInArchive means the downloaded asset is an archive without a file named after the
+	// executable, so WithInstallPlan must say which member to install.
+	ErrNoExecutableInArchive = errors.New("archive doesn't contain the executable, set an install plan")
+)
+
+// WithInstallPlan installs every artifact instead of just the downloaded asset.
+//
+// Every artifact is validated before any is installed, and they are installed as one transaction: if
+// one can't be installed, none are. The verifiers run on the artifact installed at the executable
+// path, so the plan must include the executable itself, e.g Artifact{Member: "savvy", Destination: "savvy"};
+// otherwise Upgrade fails with an error wrapping ErrNoExecutableInPlan.
+func WithInstallPlan(artifacts ...Artifact) Opt {
+	return func(u *upgrader) {
+		u.plan = append(u.plan, artifacts...)
+	}
+}
+
+// installPlan returns the artifacts to install, with absolute destinations.
+func (u *upgrader) installPlan(executablePath string) []Artifact {
+	if len(u.plan) == 0 {
+		return []Artifact{{Destination: executablePath}}
+	}
+	plan := make([]Artifact, 0, len(u.plan))
+	for _, a := range u.plan {
+		if !filepath.IsAbs(a.Destination) {
+			a.Destination = filepath.Join(filepath.Dir(executablePath), a.Destination)
+		}
+		plan = append(plan, a)
+	}
+	return plan
+}
+
+// assetPlan returns plan for the downloaded asset called name.
+//
+// An archive can't be installed as the executable, so without an install plan the file named after
+// the executable is extracted from it.
+func (u *upgrader) assetPlan(plan []Artifact, executablePath, name string) []Artifact {
+	if len(u.plan) > 0 || archive.Format(name) == "" {
+		return plan
+	}
+	return []Artifact{{Member: filepath.Base(executablePath), Destination: executablePath}}
+}
+
+// stagePlan downloads, extracts and validates every artifact in plan, returning the files to install.
+//
+// The files are created next to the downloaded asset, whose checksum must already be valid. They are
+// returned even if an error is returned, so that the caller can remove them.
+func (u *upgrader) stagePlan(ctx context.Context, plan []Artifact, releaseInfo *release.Info, downloadInfo *asset.Info, downloader asset.Downloader) ([]install.Item, error) {
+	items := make([]install.Item, len(plan))
+	var members []string
+	for i, a := range plan {
+		items[i] = install.Item{Source: downloadInfo.DownloadedBinaryFilePath, Target: a.Destination, Mode: a.Mode}
+		if a.Member != "" {
+			members = append(members, a.Member)
+		}
+	}
+
+	if len(members) > 0 {
+		dir := filepath.Dir(downloadInfo.DownloadedBinaryFilePath)
+		extracted, err := archive.Extract(downloadInfo.DownloadedBinaryFilePath, downloadInfo.Asset.Name, members, func(string) (*os.File, error) {
+			return os.CreateTemp(dir, install.TempPattern(u.installPath))
+		})
+		for i, a := range plan {
+			if m, ok := extracted[a.Member]; ok && a.Member != "" {
+				items[i].Source = m.Path
+				if err := os.Chmod(m.Path, m.Mode); err != nil {
+					return items, err
+				}
+			}
+		}
+		if err != nil {
+			return items, err
+		}
+	}
+
+	for i, a := range plan {
+		if a.Asset == "" {
+			continue
+		}
+		path, err := u.fetchAsset(ctx, a.Asset, releaseInfo, downloader)
+		if path != "" {
+			items[i].Source = path
+		}
+		if err != nil {
+			return items, err
+		}
+	}
+	return items, nil
+}
+
+// fetchAsset downloads the release asset called name and validates its checksum.
+func (u *upgrader) fetchAsset(ctx context.Context, name string, releaseInfo *release.Info, downloader asset.Downloader) (string, error) {
+	fetcher, ok := downloader.(asset.Fetcher)
+	if !ok {
+		return "", fmt.Errorf("asset downloader can't download %s", name)
+	}
+	var target *release.Asset
+	for i := range releaseInfo.Assets {
+		if releaseInfo.Assets[i].Name == name {
+			target = &releaseInfo.Assets[i]
+			break
+		}
+	}
+	if target == nil {
+		return "", fmt.Errorf("%w: %s", ErrNoPlanAsset, name)
+	}
+
+	info, _, err := fetcher.Fetch(ctx, *target)
+	if err != nil {
+		return "", err
+	}
+	checksumInfo, err := u.downloadChecksums(ctx, *target, releaseInfo.Assets)
+	if err != nil {
+		return info.DownloadedBinaryFilePath, err
+	}
+	digest, ok := info.Digest(checksumInfo.Algorithm)
+	if !ok {
+		return info.DownloadedBinaryFilePath, fmt.Errorf("%w: no %s digest for %s", ErrInvalidCheckSum, checksumInfo.Algorithm, name)
+	}
+	return info.DownloadedBinaryFilePath, u.validateChecksum(ctx, *target, checksumInfo, digest)
+}
+
+// removeSources removes the staged files that weren't installed.
+func removeSources(items []install.Item) {
+	for _, item := range items {
+		os.Remove(item.Source)
+	}
+}
@@ -0,0 +1,186 @@
+package upgrade
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/install"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeArchive writes a tar.gz release archive containing files, keyed on name, to dir.
+func writeArchive(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(dir, "savvy_linux_amd64.tar.gz")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(body)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(body))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return path
+}
+
+func TestInstallPlan(t *testing.T) {
+	dir := t.TempDir()
+	executablePath := filepath.Join(dir, "savvy")
+
+	t.Run("Default", func(t *testing.T) {
+		u := &upgrader{}
+		assert.Equal(t, []Artifact{{Destination: executablePath}}, u.installPlan(executablePath))
+	})
+	t.Run("RelativeDestinations", func(t *testing.T) {
+		u := &upgrader{}
+		WithInstallPlan(
+			Artifact{Member: "savvy", Destination: "savvy"},
+			Artifact{Member: "completions/savvy.zsh", Destination: "/usr/share/zsh/site-functions/_savvy", Mode: 0644},
+		)(u)
+		assert.Equal(t, []Artifact{
+			{Member: "savvy", Destination: executablePath},
+			{Member: "completions/savvy.zsh", Destination: "/usr/share/zsh/site-functions/_savvy", Mode: 0644},
+		}, u.installPlan(executablePath))
+	})
+}
+
+func TestPreparePlan(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("NoExecutable", func(t *testing.T) {
+		_, u := newTestUpgrader(t, "old", WithInstallPlan(Artifact{Member: "savvyd", Destination: "savvyd"}))
+		_, err := u.prepare(ctx, "0.1.0", false)
+		assert.ErrorIs(t, err, ErrNoExecutableInPlan)
+	})
+	t.Run("EscalateSeveralFiles", func(t *testing.T) {
+		if runtime.GOOS == "windows" || os.Getuid() == 0 {
+			t.Skip("directory permissions can't be enforced")
+		}
+		executable, u := newTestUpgrader(t, "old", WithPrivilegeEscalation(), WithInstallPlan(
+			Artifact{Member: "savvy", Destination: "savvy"},
+			Artifact{Member: "savvyd", Destination: "savvyd"},
+		))
+		dir := filepath.Dir(executable)
+		assert.NoError(t, os.Chmod(dir, 0555))
+		t.Cleanup(func() { os.Chmod(dir, 0755) })
+
+		_, err := u.prepare(ctx, "0.1.0", true)
+		assert.ErrorIs(t, err, ErrPlanNotEscalatable)
+		assert.ErrorIs(t, err, install.ErrPermissionDenied)
+	})
+}
+
+func TestArchiveWithoutPlan(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "ExtractExecutable",
+			files: map[string]string{"savvy_0.2.0_linux_amd64/savvy": "new", "savvy_0.2.0_linux_amd64/README.md": "readme"},
+			want:  "new",
+		},
+		{
+			name:    "NoExecutable",
+			files:   map[string]string{"savvy_0.2.0_linux_amd64/savvy-cli": "new"},
+			want:    "old",
+			wantErr: ErrNoExecutableInArchive,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			archivePath := writeArchive(t, t.TempDir(), tc.files)
+			data, err := os.ReadFile(archivePath)
+			assert.NoError(t, err)
+			executable, u := newTestUpgrader(t, "old")
+			u.assetDownloader = fakeDownloader{dir: filepath.Dir(executable), content: string(data), name: filepath.Base(archivePath)}
+
+			err = u.Upgrade(ctx, "0.1.0")
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assertContent(t, executable, tc.want)
+			assertOnlyExecutable(t, executable)
+		})
+	}
+}
+
+func TestStagePlan(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	executablePath := filepath.Join(dir, "savvy")
+	archivePath := writeArchive(t, dir, map[string]string{
+		"savvy_1.0.0_linux_amd64/savvy":  "savvy binary",
+		"savvy_1.0.0_linux_amd64/savvyd": "savvyd binary",
+	})
+	downloadInfo := &asset.Info{
+		Asset:                    release.Asset{Name: "savvy_linux_amd64.tar.gz"},
+		DownloadedBinaryFilePath: archivePath,
+	}
+	releaseInfo := &release.Info{TagName: "v1.0.0"}
+	downloader := asset.NewAssetDownloader(executablePath)
+
+	t.Run("ExtractMembers", func(t *testing.T) {
+		u := &upgrader{installPath: executablePath}
+		WithInstallPlan(
+			Artifact{Member: "savvy", Destination: "savvy"},
+			Artifact{Member: "savvyd", Destination: "savvyd", Mode: 0700},
+		)(u)
+		items, err := u.stagePlan(ctx, u.installPlan(executablePath), releaseInfo, downloadInfo, downloader)
+		assert.NoError(t, err)
+		if assert.Len(t, items, 2) {
+			assert.Equal(t, executablePath, items[0].Target)
+			assert.Equal(t, filepath.Join(dir, "savvyd"), items[1].Target)
+			assert.Equal(t, os.FileMode(0700), items[1].Mode)
+		}
+
+		assert.NoError(t, u.replaceBinary(ctx, items, HookInfo{}))
+		data, err := os.ReadFile(filepath.Join(dir, "savvyd"))
+		assert.NoError(t, err)
+		assert.Equal(t, "savvyd binary", string(data))
+		// the extracted files were installed, so there is nothing left to remove.
+		for _, item := range items {
+			assert.NoFileExists(t, item.Source)
+		}
+	})
+	t.Run("MissingAsset", func(t *testing.T) {
+		u := &upgrader{installPath: executablePath}
+		WithInstallPlan(
+			Artifact{Member: "savvy", Destination: "savvy"},
+			Artifact{Asset: "savvy.zsh", Destination: "_savvy"},
+		)(u)
+		items, err := u.stagePlan(ctx, u.installPlan(executablePath), releaseInfo, downloadInfo, downloader)
+		assert.ErrorIs(t, err, ErrNoPlanAsset)
+		removeSources(items)
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		for _, e := range entries {
+			assert.NotRegexp(t, `\.upgrade-.*\.tmp$`, e.Name())
+		}
+	})
+	t.Run("NotAnArchive", func(t *testing.T) {
+		u := &upgrader{installPath: executablePath}
+		WithInstallPlan(Artifact{Member: "savvy", Destination: "savvy"})(u)
+		info := *downloadInfo
+		info.Asset.Name = "savvy_linux_amd64"
+		_, err := u.stagePlan(ctx, u.installPlan(executablePath), releaseInfo, &info, downloader)
+		assert.Error(t, err)
+	})
+}
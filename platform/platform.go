@@ -0,0 +1,163 @@
+package platform
+
+import (
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// Platform describes the operating system and architecture a binary is built for.
+type Platform struct {
+	// OS is the canonical GOOS value, e.g darwin.
+	OS string
+	// Arch is the canonical GOARCH value, e.g amd64.
+	Arch string
+	// Variant distinguishes sub-architectures, e.g 7 for armv7.
+	Variant string
+	// Libc is the C library on linux, e.g gnu or musl.
+	Libc string
+}
+
+// osAliases lists the names used in release assets for each canonical OS, most common first.
+var osAliases = map[string][]string{
+	"darwin":  {"darwin", "macos", "osx"},
+	"linux":   {"linux"},
+	"windows": {"windows", "win"},
+	"freebsd": {"freebsd"},
+}
+
+// archAliases lists the names used in release assets for each canonical arch, most common first.
+var archAliases = map[string][]string{
+	"amd64": {"amd64", "x86_64", "x64"},
+	"386":   {"386", "i386", "i686", "x86"},
+	"arm64": {"arm64", "aarch64"},
+	"arm":   {"arm"},
+}
+
+// variantAliases lists the names used for arm variants, which are preferred over the plain arm alias.
+var variantAliases = map[string][]string{
+	"5": {"armv5", "armel"},
+	"6": {"armv6"},
+	"7": {"armv7", "armv7l", "armhf"},
+}
+
+// universalArchs are arch names for binaries that run on every architecture of an OS,
+// e.g goreleaser's darwin_all universal binaries.
+var universalArchs = []string{"all", "universal"}
+
+// New returns the Platform for os and arch, which may be any of the known aliases.
+//
+// Unknown values are kept as is, in lower case.
+func New(os, arch string) Platform {
+	p := Platform{
+		OS:   canonical(osAliases, strings.ToLower(os)),
+		Arch: canonical(archAliases, strings.ToLower(arch)),
+	}
+	for variant, aliases := range variantAliases {
+		if slices.Contains(aliases, strings.ToLower(arch)) {
+			p.Arch, p.Variant = "arm", variant
+		}
+	}
+	return p
+}
+
+// Current returns the Platform of the running binary.
+func Current() Platform {
+	p := New(runtime.GOOS, runtime.GOARCH)
+	if p.Arch == "arm" {
+		p.Variant = goarm()
+	}
+	if p.OS == "linux" {
+		p.Libc = libc()
+	}
+	return p
+}
+
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Arch
+	if p.Variant != "" {
+		s += "/v" + p.Variant
+	}
+	return s
+}
+
+// OSNames returns the names p.OS may appear as in release assets, most preferred first.
+func (p Platform) OSNames() []string {
+	if aliases, ok := osAliases[p.OS]; ok {
+		return aliases
+	}
+	return []string{p.OS}
+}
+
+// ArchNames returns the names p.Arch may appear as in release assets, most preferred first.
+//
+// ArchNames does not include universal binaries; see FallbackArchNames.
+func (p Platform) ArchNames() []string {
+	var names []string
+	if p.Arch == "arm" {
+		names = append(names, variantAliases[p.Variant]...)
+	}
+	if aliases, ok := archAliases[p.Arch]; ok {
+		return append(names, aliases...)
+	}
+	return append(names, p.Arch)
+}
+
+// FallbackArchNames returns the arch names of binaries that can run on p regardless of its arch.
+func (p Platform) FallbackArchNames() []string {
+	return universalArchs
+}
+
+// Suffixes returns every $os_$arch pair for p, most preferred first.
+//
+// Exact arch names are always preferred over FallbackArchNames.
+func (p Platform) Suffixes() []string {
+	archs := append(append([]string{}, p.ArchNames()...), p.FallbackArchNames()...)
+	var suffixes []string
+	for _, arch := range archs {
+		for _, os := range p.OSNames() {
+			suffixes = append(suffixes, os+"_"+arch)
+		}
+	}
+	return suffixes
+}
+
+// IsUniversalArch reports whether arch names a universal binary.
+func IsUniversalArch(arch string) bool {
+	return slices.Contains(universalArchs, strings.ToLower(arch))
+}
+
+func canonical(aliases map[string][]string, name string) string {
+	for c, names := range aliases {
+		if slices.Contains(names, name) {
+			return c
+		}
+	}
+	return name
+}
+
+// goarm returns the GOARM value the running binary was built with.
+func goarm() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "GOARM" {
+			// GOARM may carry a float ABI suffix, e.g 7,softfloat
+			variant, _, _ := strings.Cut(setting.Value, ",")
+			return variant
+		}
+	}
+	return ""
+}
+
+// libc guesses the C library of the running linux system from the dynamic loader that is installed.
+func libc() string {
+	if matches, _ := filepath.Glob("/lib/ld-musl-*.so.1"); len(matches) > 0 {
+		return "musl"
+	}
+	return "gnu"
+}
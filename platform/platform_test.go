@@ -0,0 +1,45 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		os, arch string
+		expected Platform
+	}{
+		{os: "linux", arch: "amd64", expected: Platform{OS: "linux", Arch: "amd64"}},
+		{os: "Linux", arch: "x86_64", expected: Platform{OS: "linux", Arch: "amd64"}},
+		{os: "macos", arch: "aarch64", expected: Platform{OS: "darwin", Arch: "arm64"}},
+		{os: "linux", arch: "i386", expected: Platform{OS: "linux", Arch: "386"}},
+		{os: "linux", arch: "armv7", expected: Platform{OS: "linux", Arch: "arm", Variant: "7"}},
+		{os: "plan9", arch: "mips", expected: Platform{OS: "plan9", Arch: "mips"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.os+"_"+tc.arch, func(t *testing.T) {
+			assert.Equal(t, tc.expected, New(tc.os, tc.arch))
+		})
+	}
+}
+
+func TestSuffixes(t *testing.T) {
+	t.Run("ExactAliasesBeforeUniversal", func(t *testing.T) {
+		suffixes := New("linux", "386").Suffixes()
+		assert.Equal(t, []string{
+			"linux_386", "linux_i386", "linux_i686", "linux_x86",
+			"linux_all", "linux_universal",
+		}, suffixes)
+	})
+	t.Run("OSAliases", func(t *testing.T) {
+		suffixes := New("darwin", "arm64").Suffixes()
+		assert.Equal(t, []string{"darwin_arm64", "macos_arm64", "osx_arm64"}, suffixes[:3])
+		assert.Contains(t, suffixes, "darwin_all")
+	})
+	t.Run("ArmVariantBeforePlainArm", func(t *testing.T) {
+		suffixes := New("linux", "armv7").Suffixes()
+		assert.Equal(t, []string{"linux_armv7", "linux_armv7l", "linux_armhf", "linux_arm"}, suffixes[:4])
+	})
+}
@@ -0,0 +1,47 @@
+package upgrade
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// UpgradedFromEnv is set by Reexec to the version the executable was upgraded from.
+const UpgradedFromEnv = "UPGRADE_CLI_UPGRADED_FROM"
+
+// Reexec replaces the current process with the executable at executablePath, e.g after Upgrade, so
+// that a CLI can upgrade and then carry on with the new version.
+//
+// The executable runs with the original arguments and environment, plus UpgradedFromEnv set to
+// fromVersion so that it can tell it was just upgraded with JustUpgraded. On success Reexec doesn't
+// return. On windows, where a process can't be replaced, the executable runs as a child process and
+// the current process exits with its exit code.
+func Reexec(executablePath, fromVersion string) error {
+	if err := reexec(executablePath, os.Args, reexecEnv(os.Environ(), fromVersion)); err != nil {
+		return fmt.Errorf("failed to run %s: %w", executablePath, err)
+	}
+	return nil
+}
+
+// reexecEnv returns environ with UpgradedFromEnv set to fromVersion, replacing the entry of an
+// earlier upgrade, e.g when upgrades are chained, since lookups may return either.
+func reexecEnv(environ []string, fromVersion string) []string {
+	env := make([]string, 0, len(environ)+1)
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, UpgradedFromEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	return append(env, UpgradedFromEnv+"="+fromVersion)
+}
+
+// JustUpgraded reports whether the process was started by Reexec, and the version it was upgraded from.
+//
+// It unsets UpgradedFromEnv, so that processes started by the executable don't inherit it.
+func JustUpgraded() (string, bool) {
+	from, ok := os.LookupEnv(UpgradedFromEnv)
+	if ok {
+		os.Unsetenv(UpgradedFromEnv)
+	}
+	return from, ok
+}
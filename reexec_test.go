@@ -0,0 +1,72 @@
+package upgrade
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reexecHelperEnv makes TestReexecHelper re-exec into the executable it names.
+const reexecHelperEnv = "UPGRADE_CLI_TEST_REEXEC"
+
+func TestReexecHelper(t *testing.T) {
+	path := os.Getenv(reexecHelperEnv)
+	if path == "" {
+		t.Skip("only runs as a helper process")
+	}
+	os.Unsetenv(reexecHelperEnv)
+	err := Reexec(path, "0.1.0")
+	t.Fatalf("Reexec returned: %v", err)
+}
+
+func TestReexec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts can't be executed on windows")
+	}
+	// the "new version" prints its arguments and the version it was upgraded from.
+	executable := filepath.Join(t.TempDir(), "savvy")
+	script := "#!/bin/sh\necho \"$@ from $" + UpgradedFromEnv + "\"\n"
+	assert.NoError(t, os.WriteFile(executable, []byte(script), 0755))
+
+	tests := []struct {
+		name string
+		env  []string
+	}{
+		{name: "NotUpgraded"},
+		// e.g the process was started by an earlier Reexec, and was upgraded again.
+		{name: "UpgradedBefore", env: []string{UpgradedFromEnv + "=0.0.9"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestReexecHelper$")
+			cmd.Env = append(append(os.Environ(), tc.env...), reexecHelperEnv+"="+executable)
+			out, err := cmd.CombinedOutput()
+			assert.NoError(t, err)
+			assert.Equal(t, "-test.run=^TestReexecHelper$ from 0.1.0\n", string(out))
+		})
+	}
+}
+
+func TestReexecEnv(t *testing.T) {
+	env := reexecEnv([]string{"HOME=/home/savvy", UpgradedFromEnv + "=0.0.9", UpgradedFromEnv + "X=1"}, "0.1.0")
+	assert.Equal(t, []string{"HOME=/home/savvy", UpgradedFromEnv + "X=1", UpgradedFromEnv + "=0.1.0"}, env)
+}
+
+func TestJustUpgraded(t *testing.T) {
+	t.Setenv(UpgradedFromEnv, "")
+	os.Unsetenv(UpgradedFromEnv)
+	_, ok := JustUpgraded()
+	assert.False(t, ok)
+
+	t.Setenv(UpgradedFromEnv, "0.1.0")
+	from, ok := JustUpgraded()
+	assert.True(t, ok)
+	assert.Equal(t, "0.1.0", from)
+	// the marker is only seen once
+	_, ok = JustUpgraded()
+	assert.False(t, ok)
+}
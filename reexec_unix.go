@@ -0,0 +1,10 @@
+//go:build !windows
+
+package upgrade
+
+import "syscall"
+
+// reexec replaces the current process with path.
+func reexec(path string, args, env []string) error {
+	return syscall.Exec(path, args, env)
+}
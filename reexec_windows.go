@@ -0,0 +1,24 @@
+package upgrade
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// reexec runs path as a child process and exits with its exit code, since windows can't replace a process.
+func reexec(path string, args, env []string) error {
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
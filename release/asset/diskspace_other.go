@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package asset
+
+// freeDiskSpace is not implemented on this platform; the download fails when the disk is full instead.
+func freeDiskSpace(dir string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package asset
+
+import "syscall"
+
+// freeDiskSpace returns the number of bytes available to unprivileged users in the filesystem containing dir.
+func freeDiskSpace(dir string) (uint64, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, false
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), true
+}
@@ -2,65 +2,163 @@ package asset
 
 import (
 	"context"
-	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"runtime"
 	"strings"
 
+	"github.com/getsavvyinc/upgrade-cli/archive"
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/install"
+	"github.com/getsavvyinc/upgrade-cli/platform"
 	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/transport"
 )
 
-type cleanupFn func() error
+// cleanupFn is an alias, so that downloaders can be implemented outside this package.
+type cleanupFn = func() error
 
 type Downloader interface {
 	DownloadAsset(ctx context.Context, ReleaseAssets []release.Asset) (*Info, cleanupFn, error)
 }
 
+// Selector is implemented by downloaders that can tell which asset of a release they would download.
+type Selector interface {
+	SelectAsset(info *release.Info) (release.Asset, bool)
+}
+
+// ReleaseDownloader is implemented by downloaders that select the asset using the whole release,
+// e.g to match the release's version in asset names.
+type ReleaseDownloader interface {
+	DownloadRelease(ctx context.Context, info *release.Info) (*Info, cleanupFn, error)
+}
+
+// Fetcher downloads a specific release asset, e.g a support file that isn't built per platform.
+type Fetcher interface {
+	Fetch(ctx context.Context, asset release.Asset) (*Info, cleanupFn, error)
+}
+
 type Info struct {
-	Checksum                 string
+	// Asset is the release asset that was downloaded.
+	Asset release.Asset
+	// Checksum is the hex encoded sha256 digest of the downloaded asset.
+	Checksum string
+	// Digests holds the hex encoded digest of the downloaded asset for every checksum.SupportedAlgorithms.
+	Digests                  map[checksum.Algorithm]string
 	DownloadedBinaryFilePath string
 }
 
+// Digest returns the hex encoded digest of the downloaded asset computed with algorithm.
+//
+// An empty algorithm is treated as checksum.SHA256.
+func (i *Info) Digest(algorithm checksum.Algorithm) (string, bool) {
+	if algorithm == "" || algorithm == checksum.SHA256 {
+		return i.Checksum, i.Checksum != ""
+	}
+	digest, ok := i.Digests[algorithm]
+	return digest, ok
+}
+
 type downloader struct {
-	os                 string
-	arch               string
+	platform           platform.Platform
 	lookupArchFallback map[string][]string
 	executablePath     string
+	downloadDir        string
+	fallbackDir        string
+	maxDownloadSize    int64
+	client             *http.Client
+	matcher            Matcher
 }
 
-var _ Downloader = (*downloader)(nil)
+var (
+	_ Downloader = (*downloader)(nil)
+	_ Fetcher    = (*downloader)(nil)
+	_ Selector   = (*downloader)(nil)
+
+	_ ReleaseDownloader = (*downloader)(nil)
+)
 
 type AssetDownloadOpt func(*downloader)
 
 func WithOS(os string) AssetDownloadOpt {
 	return func(d *downloader) {
-		d.os = os
+		d.platform.OS = platform.New(os, "").OS
 	}
 }
 
 func WithArch(arch string) AssetDownloadOpt {
 	return func(d *downloader) {
-		d.arch = arch
+		p := platform.New("", arch)
+		d.platform.Arch, d.platform.Variant = p.Arch, p.Variant
+	}
+}
+
+// WithPlatform sets the platform to download the asset for. It defaults to platform.Current.
+func WithPlatform(p platform.Platform) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.platform = p
 	}
 }
 
+// WithLookupArchFallback replaces the platform's arch aliases with an explicit list of fallback archs.
+//
+// Passing an empty map disables fallbacks altogether.
 func WithLookupArchFallback(lookupArchFallback map[string][]string) AssetDownloadOpt {
 	return func(d *downloader) {
 		d.lookupArchFallback = lookupArchFallback
 	}
 }
 
+// WithDownloadDir sets the directory the asset is downloaded to.
+//
+// It defaults to the directory containing the executable, so that the download can be renamed over
+// the executable without crossing filesystems.
+func WithDownloadDir(dir string) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.downloadDir = dir
+	}
+}
+
+// WithFallbackDownloadDir sets the directory the asset is downloaded to when it can't be downloaded next
+// to the executable, e.g because the filesystem is full.
+//
+// It defaults to an upgrade-cli directory in the user's cache directory, or the temp directory if
+// there is none. It is ignored if WithDownloadDir is used.
+func WithFallbackDownloadDir(dir string) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.fallbackDir = dir
+	}
+}
+
+// DefaultMaxDownloadSize is the largest asset that will be downloaded.
+const DefaultMaxDownloadSize int64 = 512 << 20
+
+// WithMaxDownloadSize limits the size of the asset that will be downloaded.
+func WithMaxDownloadSize(size int64) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.maxDownloadSize = size
+	}
+}
+
+// WithHTTPClient sets the client used to download assets. It defaults to transport.NewClient.
+func WithHTTPClient(c *http.Client) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.client = c
+	}
+}
+
 func NewAssetDownloader(executablePath string, opts ...AssetDownloadOpt) Downloader {
 	d := &downloader{
-		os:             runtime.GOOS,
-		arch:           runtime.GOARCH,
-		executablePath: executablePath,
+		platform:        platform.Current(),
+		executablePath:  executablePath,
+		maxDownloadSize: DefaultMaxDownloadSize,
+		client:          transport.NewClient(),
 	}
 	for _, opt := range opts {
 		opt(d)
@@ -68,34 +166,104 @@ func NewAssetDownloader(executablePath string, opts ...AssetDownloadOpt) Downloa
 	return d
 }
 
-var ErrNoAsset = errors.New("no asset found")
+// DefaultFallbackDir returns the directory assets are downloaded to when they can't be downloaded next to
+// the executable, unless WithFallbackDownloadDir is used.
+func DefaultFallbackDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "upgrade-cli")
+	}
+	return os.TempDir()
+}
 
-func (d *downloader) DownloadAsset(ctx context.Context, assets []release.Asset) (*Info, cleanupFn, error) {
-	// iterate through the assets and find the one that matches the os and arch
-	suffix := d.os + "_" + d.arch
-	asset, found := d.assetForSuffix(assets, suffix)
-	if found {
-		return d.downloadAsset(ctx, asset.BrowserDownloadURL)
+// createTempFile creates the file the asset is downloaded to, with room for size bytes.
+//
+// The file is created next to the executable if possible, so that it can be renamed over the
+// executable without crossing filesystems. Otherwise it is created in the fallback directory.
+func (d *downloader) createTempFile(url string, size int64) (*os.File, error) {
+	executable := filepath.Base(d.executablePath)
+	dirs := []string{filepath.Dir(d.executablePath), d.fallbackDir}
+	if d.downloadDir != "" {
+		dirs = []string{d.downloadDir}
+	} else if d.fallbackDir == "" {
+		dirs[1] = DefaultFallbackDir()
 	}
-	// if asset not found, try a fallback. e.g amd64 -> x86_64
-	if len(d.lookupArchFallback) == 0 {
-		return nil, nil, fmt.Errorf("%w: os:%s arch:%s", ErrNoAsset, d.os, d.arch)
+
+	var errs []error
+	for i, dir := range dirs {
+		if free, ok := freeDiskSpace(dir); ok && size > 0 && uint64(size) > free {
+			errs = append(errs, fmt.Errorf("%w: %s needs %d bytes, %d available in %s", ErrInsufficientDiskSpace, url, size, free, dir))
+			continue
+		}
+		// only the fallback directory is created; the executable's directory must already exist.
+		if i > 0 {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		f, err := os.CreateTemp(dir, install.TempPattern(executable))
+		if err == nil {
+			return f, nil
+		}
+		errs = append(errs, err)
 	}
+	return nil, errors.Join(errs...)
+}
+
+var (
+	ErrNoAsset               = errors.New("no asset found")
+	ErrAssetTooLarge         = errors.New("asset too large")
+	ErrTruncatedDownload     = errors.New("truncated download")
+	ErrInsufficientDiskSpace = errors.New("insufficient disk space")
+)
+
+// DownloadAsset downloads the asset for the platform. Since the release's version is unknown, a
+// Matcher accepts assets of any version.
+func (d *downloader) DownloadAsset(ctx context.Context, assets []release.Asset) (*Info, cleanupFn, error) {
+	return d.DownloadRelease(ctx, &release.Info{Assets: assets})
+}
 
-	fallbackArchs, ok := d.lookupArchFallback[d.arch]
-	if !ok {
-		return nil, nil, fmt.Errorf("%w: os:%s arch:%s", ErrNoAsset, d.os, d.arch)
+// DownloadRelease downloads the release's asset for the platform.
+func (d *downloader) DownloadRelease(ctx context.Context, info *release.Info) (*Info, cleanupFn, error) {
+	if asset, found := d.SelectAsset(info); found {
+		return d.downloadAsset(ctx, asset)
 	}
+	return nil, nil, fmt.Errorf("%w: os:%s arch:%s", ErrNoAsset, d.platform.OS, d.platform.Arch)
+}
 
-	// Try to find an asset for each fallback architecture
-	for _, fallbackArch := range fallbackArchs {
-		fallbackSuffix := d.os + "_" + fallbackArch
-		asset, found = d.assetForSuffix(assets, fallbackSuffix)
-		if found {
-			return d.downloadAsset(ctx, asset.BrowserDownloadURL)
+// SelectAsset returns the release's asset for the platform.
+func (d *downloader) SelectAsset(info *release.Info) (release.Asset, bool) {
+	if d.matcher != nil {
+		return d.matcher.Match(info.Assets, info.TagName, d.platform)
+	}
+	// iterate through the suffixes, most preferred first, and find an asset that matches it.
+	for _, suffix := range d.suffixes() {
+		if asset, found := d.assetForSuffix(info.Assets, suffix); found {
+			return asset, true
 		}
 	}
-	return nil, nil, fmt.Errorf("%w: os:%s arch:%s", ErrNoAsset, d.os, d.arch)
+	return release.Asset{}, false
+}
+
+// Fetch downloads asset, regardless of the platform it is for.
+func (d *downloader) Fetch(ctx context.Context, asset release.Asset) (*Info, cleanupFn, error) {
+	return d.downloadAsset(ctx, asset)
+}
+
+// suffixes returns the $os_$arch suffixes to look for.
+//
+// If WithLookupArchFallback was used, the fallback map takes the place of the platform's aliases.
+func (d *downloader) suffixes() []string {
+	if d.lookupArchFallback == nil {
+		return d.platform.Suffixes()
+	}
+
+	// if asset not found, try a fallback. e.g amd64 -> x86_64
+	suffixes := []string{d.platform.OS + "_" + d.platform.Arch}
+	for _, fallbackArch := range d.lookupArchFallback[d.platform.Arch] {
+		suffixes = append(suffixes, d.platform.OS+"_"+fallbackArch)
+	}
+	return suffixes
 }
 
 func (d *downloader) assetForSuffix(assets []release.Asset, suffix string) (release.Asset, bool) {
@@ -104,26 +272,43 @@ func (d *downloader) assetForSuffix(assets []release.Asset, suffix string) (rele
 			return asset, true
 		}
 	}
+	// uncompressed assets are preferred, since they can be patched.
+	for _, asset := range assets {
+		if strings.HasSuffix(archive.TrimCompression(asset.BrowserDownloadURL), suffix) {
+			return asset, true
+		}
+	}
 	return release.Asset{}, false
 }
 
-func (d *downloader) downloadAsset(ctx context.Context, url string) (*Info, cleanupFn, error) {
+func (d *downloader) downloadAsset(ctx context.Context, asset release.Asset) (*Info, cleanupFn, error) {
+	if asset.Size > d.maxDownloadSize {
+		return nil, nil, fmt.Errorf("%w: %s is %d bytes, limit is %d", ErrAssetTooLarge, asset.BrowserDownloadURL, asset.Size, d.maxDownloadSize)
+	}
+
 	// Download the file
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.BrowserDownloadURL, nil)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := d.client.Do(req)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
-	// Create a temporary file in the same directory as the executable
-	// Doing so avoids issues where the downloaded file is on a different filesystem/mount point from the executable.
-	executable, executableDir := filepath.Base(d.executablePath), filepath.Dir(d.executablePath)
-	tmpFile, err := os.CreateTemp(executableDir, executable)
+	if resp.ContentLength > d.maxDownloadSize {
+		return nil, nil, fmt.Errorf("%w: %s is %d bytes, limit is %d", ErrAssetTooLarge, asset.BrowserDownloadURL, resp.ContentLength, d.maxDownloadSize)
+	}
+
+	// the size GitHub reports is authoritative; Content-Length is only used when it is unknown.
+	expectedSize := asset.Size
+	if expectedSize <= 0 {
+		expectedSize = resp.ContentLength
+	}
+
+	tmpFile, err := d.createTempFile(asset.BrowserDownloadURL, expectedSize)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -133,25 +318,142 @@ func (d *downloader) downloadAsset(ctx context.Context, url string) (*Info, clea
 		return os.Remove(tmpFile.Name())
 	}
 
-	// sha256 checksum
-	hasher := sha256.New()
+	// compute every supported digest while streaming, since the checksum file may use any of them.
+	hashers, err := newHashers()
+	if err != nil {
+		cleanupFn()
+		return nil, nil, err
+	}
+	writers := make([]io.Writer, 0, len(hashers))
+	for _, h := range hashers {
+		writers = append(writers, h)
+	}
+	digest := io.MultiWriter(writers...)
 
-	// Write the response body to the temporary file and hasher
-	rd := io.TeeReader(resp.Body, hasher)
-	_, err = io.Copy(tmpFile, rd)
+	// Write the response body to the temporary file and hashers.
+	// Read one byte past the limit so that an oversized body is detected rather than silently truncated.
+	body := io.LimitReader(resp.Body, d.maxDownloadSize+1)
+	var written int64
+	if compression := archive.Compression(assetName(asset)); compression != "" {
+		// checksum files list the digest of the compressed asset, but the decompressed file is installed.
+		written, err = copyDecompressed(tmpFile, io.TeeReader(body, digest), compression)
+	} else {
+		written, err = io.Copy(io.MultiWriter(tmpFile, digest), body)
+	}
 	if err != nil {
 		cleanupFn()
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil, fmt.Errorf("%w: %s: %w", ErrTruncatedDownload, asset.BrowserDownloadURL, err)
+		}
 		return nil, nil, err
 	}
 
+	if written > d.maxDownloadSize {
+		cleanupFn()
+		return nil, nil, fmt.Errorf("%w: %s exceeds %d bytes", ErrAssetTooLarge, asset.BrowserDownloadURL, d.maxDownloadSize)
+	}
+	if expectedSize >= 0 && written != expectedSize {
+		cleanupFn()
+		return nil, nil, fmt.Errorf("%w: %s: got %d bytes, expected %d", ErrTruncatedDownload, asset.BrowserDownloadURL, written, expectedSize)
+	}
+
 	// Ensure the downloaded file has executable permissions
 	if err := os.Chmod(tmpFile.Name(), 0755); err != nil {
 		cleanupFn()
 		return nil, nil, err
 	}
 
+	return newInfo(asset, tmpFile.Name(), hashers), cleanupFn, nil
+}
+
+// assetName returns the name of asset, which is the end of its URL if it has no name.
+func assetName(asset release.Asset) string {
+	if asset.Name != "" {
+		return asset.Name
+	}
+	return path.Base(asset.BrowserDownloadURL)
+}
+
+// copyDecompressed decompresses r to w and returns the number of compressed bytes read.
+//
+// The rest of r is read even if the compressed stream ends early, so that it is hashed too.
+func copyDecompressed(w io.Writer, r io.Reader, compression string) (int64, error) {
+	counter := &countingReader{r: r}
+	dr, err := archive.Decompress(counter, compression)
+	if err != nil {
+		return counter.n, fmt.Errorf("failed to decompress asset: %w", err)
+	}
+	defer dr.Close()
+
+	// the decompressed file may be much larger than the asset, so it is limited like archive members.
+	n, err := io.Copy(w, io.LimitReader(dr, archive.MaxMemberSize+1))
+	if err != nil {
+		return counter.n, fmt.Errorf("failed to decompress asset: %w", err)
+	}
+	if n > archive.MaxMemberSize {
+		return counter.n, fmt.Errorf("%w: decompressed asset exceeds %d bytes", ErrAssetTooLarge, archive.MaxMemberSize)
+	}
+	if _, err := io.Copy(io.Discard, counter); err != nil {
+		return counter.n, err
+	}
+	return counter.n, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewFileInfo returns the Info of a file at path that was produced locally rather than downloaded,
+// e.g by applying a patch, so that it can be validated as if it had been downloaded as asset.
+func NewFileInfo(asset release.Asset, path string) (*Info, error) {
+	hashers, err := newHashers()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	writers := make([]io.Writer, 0, len(hashers))
+	for _, h := range hashers {
+		writers = append(writers, h)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, err
+	}
+	return newInfo(asset, path, hashers), nil
+}
+
+// newHashers returns a hash for every checksum.SupportedAlgorithms.
+func newHashers() (map[checksum.Algorithm]hash.Hash, error) {
+	hashers := make(map[checksum.Algorithm]hash.Hash, len(checksum.SupportedAlgorithms))
+	for _, algorithm := range checksum.SupportedAlgorithms {
+		h, err := checksum.NewHash(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		hashers[algorithm] = h
+	}
+	return hashers, nil
+}
+
+func newInfo(asset release.Asset, path string, hashers map[checksum.Algorithm]hash.Hash) *Info {
+	digests := make(map[checksum.Algorithm]string, len(hashers))
+	for algorithm, h := range hashers {
+		digests[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
 	return &Info{
-		Checksum:                 hex.EncodeToString(hasher.Sum(nil)),
-		DownloadedBinaryFilePath: tmpFile.Name(),
-	}, cleanupFn, nil
+		Asset:                    asset,
+		Checksum:                 digests[checksum.SHA256],
+		Digests:                  digests,
+		DownloadedBinaryFilePath: path,
+	}
 }
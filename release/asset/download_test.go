@@ -1,13 +1,23 @@
 package asset
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 
+	"github.com/getsavvyinc/upgrade-cli/checksum"
 	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/transport"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,17 +31,33 @@ echo "Hello, World!"`
 const downloadDataChecksum = "88fd602a930bc7c0bb78c385f3cb70e976a0cdc3517020be32f19aae8c8eba17"
 
 func setupTestServer(t *testing.T, handler http.Handler) *httptest.Server {
-	srv := httptest.NewServer(handler)
+	srv := httptest.NewTLSServer(handler)
 	defer t.Cleanup(srv.Close)
 	return srv
 }
 
+// testClient returns a client that enforces the transport policy, allowing only srv.
+func testClient(srv *httptest.Server) *http.Client {
+	return transport.NewClient(
+		transport.WithAllowedHosts("127.0.0.1"),
+		transport.WithBaseTransport(srv.Client().Transport),
+	)
+}
+
 func downloadDataHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.WriteHeader(200)
 	io.WriteString(w, downloadData)
 }
 
+// truncatedDataHandler announces more bytes than it sends.
+func truncatedDataHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(downloadData)+100))
+	w.WriteHeader(200)
+	io.WriteString(w, downloadData)
+}
+
 func shouldNeverBeCalled(t *testing.T) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		t.Errorf("unexpected URL: %s", r.URL.Path)
@@ -43,7 +69,7 @@ func TestAssetDownloader(t *testing.T) {
 	t.Run("TryDownloadingMissingAsset", func(t *testing.T) {
 		srv := setupTestServer(t, shouldNeverBeCalled(t))
 		ctx := context.Background()
-		downloader := NewAssetDownloader(executablePath)
+		downloader := NewAssetDownloader(executablePath, WithHTTPClient(testClient(srv)))
 		asset, cleanupFn, err := downloader.DownloadAsset(ctx, []release.Asset{
 			{BrowserDownloadURL: srv.URL + "/nonexistent"},
 		})
@@ -54,7 +80,7 @@ func TestAssetDownloader(t *testing.T) {
 	t.Run("EnsureDownloadedDoesntChangeContent", func(t *testing.T) {
 		srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
 		ctx := context.Background()
-		downloader := NewAssetDownloader(executablePath, WithOS("os"), WithArch("arch"))
+		downloader := NewAssetDownloader(executablePath, WithHTTPClient(testClient(srv)), WithOS("os"), WithArch("arch"))
 		asset, cleanupFn, err := downloader.DownloadAsset(ctx, []release.Asset{
 			{BrowserDownloadURL: srv.URL + "/download_os_arch"},
 		})
@@ -63,6 +89,16 @@ func TestAssetDownloader(t *testing.T) {
 		assert.NotNil(t, cleanupFn)
 
 		assert.Equal(t, downloadDataChecksum, asset.Checksum)
+		assert.Equal(t, srv.URL+"/download_os_arch", asset.Asset.BrowserDownloadURL)
+		t.Run("VerifyDigests", func(t *testing.T) {
+			sum := sha512.Sum512([]byte(downloadData))
+			digest, ok := asset.Digest(checksum.SHA512)
+			assert.True(t, ok)
+			assert.Equal(t, hex.EncodeToString(sum[:]), digest)
+			for _, algorithm := range checksum.SupportedAlgorithms {
+				assert.NotEmpty(t, asset.Digests[algorithm])
+			}
+		})
 		t.Run("VerifyCleanup", func(t *testing.T) {
 			tmpFile := asset.DownloadedBinaryFilePath
 			assert.FileExists(t, tmpFile)
@@ -70,11 +106,48 @@ func TestAssetDownloader(t *testing.T) {
 			assert.NoFileExists(t, tmpFile)
 		})
 	})
+	t.Run("DownloadToDir", func(t *testing.T) {
+		srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
+		dir := t.TempDir()
+		downloader := NewAssetDownloader(filepath.Join(t.TempDir(), executablePath), WithHTTPClient(testClient(srv)),
+			WithOS("os"), WithArch("arch"), WithDownloadDir(dir))
+		asset, cleanupFn, err := downloader.DownloadAsset(context.Background(), []release.Asset{
+			{BrowserDownloadURL: srv.URL + "/download_os_arch"},
+		})
+		assert.NoError(t, err)
+		if assert.NotNil(t, cleanupFn) {
+			defer cleanupFn()
+		}
+		if assert.NotNil(t, asset) {
+			assert.Equal(t, dir, filepath.Dir(asset.DownloadedBinaryFilePath))
+		}
+	})
+	t.Run("DownloadToFallbackDir", func(t *testing.T) {
+		srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
+		dir := filepath.Join(t.TempDir(), "cache")
+		// the executable's directory doesn't exist, so the temp file can't be created next to it.
+		downloader := NewAssetDownloader(filepath.Join(t.TempDir(), "missing", executablePath), WithHTTPClient(testClient(srv)),
+			WithOS("os"), WithArch("arch"), WithFallbackDownloadDir(dir))
+		asset, cleanupFn, err := downloader.DownloadAsset(context.Background(), []release.Asset{
+			{BrowserDownloadURL: srv.URL + "/download_os_arch"},
+		})
+		assert.NoError(t, err)
+		if assert.NotNil(t, cleanupFn) {
+			defer cleanupFn()
+		}
+		if assert.NotNil(t, asset) {
+			assert.Equal(t, dir, filepath.Dir(asset.DownloadedBinaryFilePath))
+		}
+	})
 	t.Run("VerifyFallback", func(t *testing.T) {
 		srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
 		ctx := context.Background()
 		t.Run("DownloadFailsWithoutFallback", func(t *testing.T) {
-			downloader := NewAssetDownloader(executablePath, WithOS("os"), WithArch("amd64"))
+			downloader := NewAssetDownloader(executablePath, WithHTTPClient(testClient(srv)),
+				WithOS("os"),
+				WithArch("amd64"),
+				WithLookupArchFallback(map[string][]string{}),
+			)
 			asset, cleanupFn, err := downloader.DownloadAsset(ctx, []release.Asset{
 				{BrowserDownloadURL: srv.URL + "/download_os_x86_64"},
 			})
@@ -83,7 +156,7 @@ func TestAssetDownloader(t *testing.T) {
 			assert.Nil(t, cleanupFn)
 		})
 		t.Run("DownloadSucceedsWithFallback", func(t *testing.T) {
-			downloader := NewAssetDownloader(executablePath,
+			downloader := NewAssetDownloader(executablePath, WithHTTPClient(testClient(srv)),
 				WithOS("os"),
 				WithArch("amd64"),
 				WithLookupArchFallback(
@@ -94,8 +167,125 @@ func TestAssetDownloader(t *testing.T) {
 			})
 			assert.NoError(t, err)
 			assert.NotNil(t, asset)
-			assert.NotNil(t, cleanupFn)
+			if assert.NotNil(t, cleanupFn) {
+				defer cleanupFn()
+			}
 			assert.Equal(t, downloadDataChecksum, asset.Checksum)
 		})
+		t.Run("DownloadSucceedsWithPlatformAliases", func(t *testing.T) {
+			downloader := NewAssetDownloader(executablePath, WithHTTPClient(testClient(srv)), WithOS("linux"), WithArch("amd64"))
+			asset, cleanupFn, err := downloader.DownloadAsset(ctx, []release.Asset{
+				{BrowserDownloadURL: srv.URL + "/download_linux_all"},
+				{BrowserDownloadURL: srv.URL + "/download_linux_x86_64"},
+			})
+			assert.NoError(t, err)
+			if assert.NotNil(t, cleanupFn) {
+				defer cleanupFn()
+			}
+			if assert.NotNil(t, asset) {
+				// exact arch aliases are preferred over universal binaries
+				assert.Equal(t, srv.URL+"/download_linux_x86_64", asset.Asset.BrowserDownloadURL)
+			}
+		})
+	})
+	t.Run("VerifySizeLimits", func(t *testing.T) {
+		srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
+		ctx := context.Background()
+		testCases := []struct {
+			name  string
+			asset release.Asset
+			opts  []AssetDownloadOpt
+			err   error
+		}{
+			{
+				name:  "ReportedSizeExceedsLimit",
+				asset: release.Asset{BrowserDownloadURL: srv.URL + "/download_os_arch", Size: 1 << 20},
+				opts:  []AssetDownloadOpt{WithMaxDownloadSize(1024)},
+				err:   ErrAssetTooLarge,
+			},
+			{
+				name:  "ContentLengthExceedsLimit",
+				asset: release.Asset{BrowserDownloadURL: srv.URL + "/download_os_arch"},
+				opts:  []AssetDownloadOpt{WithMaxDownloadSize(10)},
+				err:   ErrAssetTooLarge,
+			},
+			{
+				name:  "SizeMismatch",
+				asset: release.Asset{BrowserDownloadURL: srv.URL + "/download_os_arch", Size: int64(len(downloadData) + 1)},
+				err:   ErrTruncatedDownload,
+			},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				opts := append([]AssetDownloadOpt{WithOS("os"), WithArch("arch"), WithHTTPClient(testClient(srv))}, tc.opts...)
+				dir := t.TempDir()
+				downloader := NewAssetDownloader(filepath.Join(dir, executablePath), opts...)
+				asset, cleanupFn, err := downloader.DownloadAsset(ctx, []release.Asset{tc.asset})
+				assert.ErrorIs(t, err, tc.err)
+				assert.Nil(t, asset)
+				assert.Nil(t, cleanupFn)
+				// the partially downloaded file is removed
+				entries, err := os.ReadDir(dir)
+				assert.NoError(t, err)
+				assert.Empty(t, entries)
+			})
+		}
+		t.Run("ReportedSizeMatches", func(t *testing.T) {
+			downloader := NewAssetDownloader(executablePath, WithHTTPClient(testClient(srv)), WithOS("os"), WithArch("arch"))
+			asset, cleanupFn, err := downloader.DownloadAsset(ctx, []release.Asset{
+				{BrowserDownloadURL: srv.URL + "/download_os_arch", Size: int64(len(downloadData))},
+			})
+			assert.NoError(t, err)
+			assert.NotNil(t, asset)
+			if assert.NotNil(t, cleanupFn) {
+				assert.NoError(t, cleanupFn())
+			}
+		})
+		t.Run("TruncatedBody", func(t *testing.T) {
+			srv := setupTestServer(t, http.HandlerFunc(truncatedDataHandler))
+			downloader := NewAssetDownloader(filepath.Join(t.TempDir(), executablePath), WithHTTPClient(testClient(srv)), WithOS("os"), WithArch("arch"))
+			asset, cleanupFn, err := downloader.DownloadAsset(ctx, []release.Asset{
+				{BrowserDownloadURL: srv.URL + "/download_os_arch"},
+			})
+			assert.ErrorIs(t, err, ErrTruncatedDownload)
+			assert.Nil(t, asset)
+			assert.Nil(t, cleanupFn)
+		})
+	})
+	t.Run("DecompressAsset", func(t *testing.T) {
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		io.WriteString(zw, downloadData)
+		assert.NoError(t, zw.Close())
+		sum := sha256.Sum256(compressed.Bytes())
+		srv := setupTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(compressed.Bytes())
+		}))
+
+		downloader := NewAssetDownloader(filepath.Join(t.TempDir(), "savvy"), WithHTTPClient(testClient(srv)), WithOS("linux"), WithArch("amd64"))
+		asset, cleanupFn, err := downloader.DownloadAsset(context.Background(), []release.Asset{
+			{Name: "savvy_linux_amd64.gz", BrowserDownloadURL: srv.URL + "/savvy_linux_amd64.gz", Size: int64(compressed.Len())},
+		})
+		assert.NoError(t, err)
+		if assert.NotNil(t, cleanupFn) {
+			defer cleanupFn()
+		}
+		// the checksum is the compressed asset's, but the downloaded file is decompressed.
+		assert.Equal(t, hex.EncodeToString(sum[:]), asset.Checksum)
+		data, err := os.ReadFile(asset.DownloadedBinaryFilePath)
+		assert.NoError(t, err)
+		assert.Equal(t, downloadData, string(data))
+
+		t.Run("PreferUncompressed", func(t *testing.T) {
+			asset, cleanupFn, err := downloader.DownloadAsset(context.Background(), []release.Asset{
+				{BrowserDownloadURL: srv.URL + "/savvy_linux_amd64.gz"},
+				{BrowserDownloadURL: srv.URL + "/savvy_linux_amd64"},
+			})
+			assert.NoError(t, err)
+			if assert.NotNil(t, cleanupFn) {
+				defer cleanupFn()
+			}
+			assert.Equal(t, srv.URL+"/savvy_linux_amd64", asset.Asset.BrowserDownloadURL)
+		})
 	})
 }
@@ -0,0 +1,240 @@
+package asset
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/getsavvyinc/upgrade-cli/platform"
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// Matcher selects the release asset for a platform by its name, for releases whose asset URLs don't
+// end in $os_$arch.
+type Matcher interface {
+	// Match returns the asset of the release tagged version built for p, preferring exact arch names
+	// over universal binaries. Assets naming another version are skipped, unless version is empty.
+	Match(assets []release.Asset, version string, p platform.Platform) (release.Asset, bool)
+}
+
+// WithMatcher selects the asset to download with m instead of matching URLs by their $os_$arch suffix.
+//
+// WithLookupArchFallback has no effect on m, which uses the platform's aliases.
+func WithMatcher(m Matcher) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.matcher = m
+	}
+}
+
+// Preset matchers for common naming conventions.
+var (
+	// GoReleaserMatcher matches goreleaser's default names, e.g savvy_1.2.3_linux_amd64.tar.gz or
+	// savvy_1.2.3_Darwin_x86_64.tar.gz.
+	GoReleaserMatcher = mustRegexMatcher(`^.+?_(?P<version>` + versionPattern + `)_(?P<os>[[:alnum:]]+)_(?P<arch>[[:alnum:]_]+?)` + extPattern + `$`)
+	// RustTargetMatcher matches names ending in a Rust target triple, with or without a version,
+	// e.g savvy-v1.2.3-x86_64-unknown-linux-musl.tar.gz or savvy-aarch64-apple-darwin.zip. Targets
+	// for the platform's C library are preferred.
+	RustTargetMatcher = mustRegexMatcher(`^.+?(?:-(?P<version>v?[0-9][[:alnum:].+~]*?))?-(?P<arch>[[:alnum:]_]+)-(?:unknown|apple|pc)-(?P<os>[[:alnum:]]+)(?:-(?P<libc>[[:alnum:]]+))?` + extPattern + `$`)
+	// CommonMatcher matches names made of the project, an optional version, the OS and the arch,
+	// separated by dashes, underscores or dots, e.g Savvy-Linux-64bit or savvy-v1.2.3-linux-arm64.zip.
+	CommonMatcher = mustRegexMatcher(`^.+?(?:[-_.](?P<version>v?[0-9][[:alnum:].+~]*?))?[-_.](?P<os>[[:alnum:]]+)[-_.](?P<arch>[[:alnum:]_]+?)` + extPattern + `$`)
+)
+
+const (
+	// extPattern matches the optional extension of an asset.
+	extPattern = `(?:\.tar\.gz|\.tgz|\.tar|\.zip|\.gz|\.bz2|\.xz|\.zst|\.exe)?`
+	// versionPattern matches a version, with or without a leading v.
+	versionPattern = `v?[0-9][[:alnum:].+~-]*?`
+)
+
+// conventionArchs lists arch names that are only used by some projects, e.g Tool-Linux-64bit.
+var conventionArchs = map[string][]string{
+	"amd64": {"64bit"},
+	"386":   {"32bit"},
+}
+
+// TemplateData holds the fields available to NewTemplateMatcher patterns.
+type TemplateData struct {
+	// Name matches any project name.
+	Name string
+	// Version matches the release's version, with or without a leading v.
+	Version string
+	// OS matches the names of the platform's OS.
+	OS string
+	// Arch matches the names of the platform's arch, and universal binaries.
+	Arch string
+	// Ext matches an optional archive or compression extension, e.g .tar.gz.
+	Ext string
+}
+
+// placeholders are executed in place of the TemplateData fields, and replaced with patterns.
+var placeholders = TemplateData{Name: "\x00name\x00", Version: "\x00version\x00", OS: "\x00os\x00", Arch: "\x00arch\x00", Ext: "\x00ext\x00"}
+
+type templateMatcher struct {
+	// pattern is the quoted template output, with the placeholders left to be replaced.
+	pattern string
+
+	mu sync.Mutex
+	// matchers holds the pattern compiled for each platform it was matched for.
+	matchers map[platform.Platform]*regexMatcher
+}
+
+// NewTemplateMatcher returns a Matcher for asset names described by a text/template pattern, e.g
+// "savvy-{{.Version}}-{{.Arch}}-unknown-{{.OS}}-musl{{.Ext}}". See TemplateData for the fields.
+// Names are matched in full and case insensitively.
+func NewTemplateMatcher(pattern string) (Matcher, error) {
+	tmpl, err := template.New("asset").Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, placeholders); err != nil {
+		return nil, err
+	}
+	m := &templateMatcher{pattern: regexp.QuoteMeta(buf.String()), matchers: make(map[platform.Platform]*regexMatcher)}
+	// compile the pattern once to report errors, e.g a field used where it can't be matched.
+	if _, err := m.compile(platform.Current()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *templateMatcher) Match(assets []release.Asset, version string, p platform.Platform) (release.Asset, bool) {
+	m.mu.Lock()
+	re, ok := m.matchers[p]
+	if !ok {
+		var err error
+		if re, err = m.compile(p); err != nil {
+			m.mu.Unlock()
+			return release.Asset{}, false
+		}
+		m.matchers[p] = re
+	}
+	m.mu.Unlock()
+	return re.Match(assets, version, p)
+}
+
+// compile returns the matcher for the names of p's OS and arch.
+func (m *templateMatcher) compile(p platform.Platform) (*regexMatcher, error) {
+	expr := m.pattern
+	// only the first use of a field can be a named group, since names must be unique.
+	for _, r := range []struct{ placeholder, name, pattern string }{
+		{placeholders.Name, "", `.+?`},
+		{placeholders.Version, "version", versionPattern},
+		{placeholders.OS, "os", alternation(p.OSNames())},
+		{placeholders.Arch, "arch", alternation(archNames(p))},
+		{placeholders.Ext, "", extPattern},
+	} {
+		if r.name != "" {
+			expr = strings.Replace(expr, r.placeholder, fmt.Sprintf("(?P<%s>%s)", r.name, r.pattern), 1)
+		}
+		expr = strings.ReplaceAll(expr, r.placeholder, "(?:"+r.pattern+")")
+	}
+	re, err := regexp.Compile("(?i)^" + expr + "$")
+	if err != nil {
+		return nil, err
+	}
+	return &regexMatcher{re: re}, nil
+}
+
+type regexMatcher struct {
+	re *regexp.Regexp
+}
+
+// NewRegexMatcher returns a Matcher for asset names matching expr.
+//
+// If expr has groups named os and arch, they must match names of the platform's OS and arch, and
+// assets are preferred in the order of the platform's arch names. A group named version must match
+// the release's version, with or without a leading v, if it matched anything. A group named libc,
+// e.g for Rust target triples, prefers assets for the platform's C library, and rejects gnu assets
+// on musl systems. Without these groups,
+// the first asset matching expr is selected.
+func NewRegexMatcher(expr string) (Matcher, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &regexMatcher{re: re}, nil
+}
+
+func mustRegexMatcher(expr string) Matcher {
+	m, err := NewRegexMatcher("(?i)" + expr)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (m *regexMatcher) Match(assets []release.Asset, version string, p platform.Platform) (release.Asset, bool) {
+	archs := archNames(p)
+	var best release.Asset
+	bestRank := -1
+	for _, asset := range assets {
+		if rank, ok := m.rank(assetName(asset), version, p, archs); ok && (bestRank < 0 || rank < bestRank) {
+			best, bestRank = asset, rank
+		}
+	}
+	return best, bestRank >= 0
+}
+
+// rank reports whether name is an asset for p, and how well it fits: lower ranks are preferred.
+func (m *regexMatcher) rank(name, version string, p platform.Platform, archs []string) (int, bool) {
+	match := m.re.FindStringSubmatch(name)
+	if match == nil {
+		return 0, false
+	}
+	if i := m.re.SubexpIndex("version"); i >= 0 && version != "" && match[i] != "" && !sameVersion(match[i], version) {
+		return 0, false
+	}
+	if i := m.re.SubexpIndex("os"); i >= 0 && !slices.Contains(p.OSNames(), strings.ToLower(match[i])) {
+		return 0, false
+	}
+	rank := 0
+	if i := m.re.SubexpIndex("arch"); i >= 0 {
+		rank = slices.Index(archs, strings.ToLower(match[i]))
+		if rank < 0 {
+			return 0, false
+		}
+		rank *= 2
+	}
+	if i := m.re.SubexpIndex("libc"); i >= 0 && p.Libc != "" && match[i] != "" {
+		libc := strings.ToLower(match[i])
+		switch {
+		case strings.HasPrefix(libc, p.Libc):
+		case p.Libc == "musl" && strings.HasPrefix(libc, "gnu"):
+			// a gnu binary can't run on a musl system.
+			return 0, false
+		default:
+			// a statically linked musl binary runs on a gnu system, but is only better than nothing.
+			rank++
+		}
+	}
+	return rank, true
+}
+
+// sameVersion reports whether two versions are the same, ignoring a leading v.
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(strings.ToLower(a), "v") == strings.TrimPrefix(strings.ToLower(b), "v")
+}
+
+// archNames returns the names p.Arch may appear as in asset names matched by a Matcher, most preferred first.
+func archNames(p platform.Platform) []string {
+	names := append([]string{}, p.ArchNames()...)
+	names = append(names, conventionArchs[p.Arch]...)
+	return append(names, p.FallbackArchNames()...)
+}
+
+// alternation returns a pattern matching any of names, longest first so that e.g armv7 is preferred over arm.
+func alternation(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return strings.Join(quoted, "|")
+}
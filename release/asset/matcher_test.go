@@ -0,0 +1,181 @@
+package asset
+
+import (
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/platform"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+)
+
+func named(names ...string) []release.Asset {
+	assets := make([]release.Asset, len(names))
+	for i, name := range names {
+		assets[i] = release.Asset{Name: name, BrowserDownloadURL: "https://github.com/getsavvyinc/savvy-cli/releases/download/v1.2.3/" + name}
+	}
+	return assets
+}
+
+func TestMatchers(t *testing.T) {
+	linux := platform.New("linux", "amd64")
+	musl := linux
+	musl.Libc = "musl"
+	mac := platform.New("darwin", "arm64")
+	armv7 := platform.New("linux", "armv7")
+
+	template := func(pattern string) Matcher {
+		m, err := NewTemplateMatcher(pattern)
+		assert.NoError(t, err)
+		return m
+	}
+	rustAssets := named(
+		"savvy-v1.2.3-x86_64-unknown-linux-gnu.tar.gz",
+		"savvy-v1.2.3-x86_64-unknown-linux-musl.tar.gz",
+		"savvy-v1.2.3-aarch64-apple-darwin.tar.gz",
+		"savvy-v1.2.3-armv7-unknown-linux-gnueabihf.tar.gz",
+		"savvy-v1.2.3-x86_64-pc-windows-msvc.zip",
+		"checksums.txt",
+	)
+
+	tests := []struct {
+		name     string
+		matcher  Matcher
+		platform platform.Platform
+		assets   []release.Asset
+		want     string
+	}{
+		{
+			name:     "GoReleaser",
+			matcher:  GoReleaserMatcher,
+			platform: linux,
+			assets:   named("savvy_1.2.3_checksums.txt", "savvy_1.2.3_Darwin_x86_64.tar.gz", "savvy_1.2.3_Linux_x86_64.tar.gz", "savvy_1.2.3_Linux_i386.tar.gz"),
+			want:     "savvy_1.2.3_Linux_x86_64.tar.gz",
+		},
+		{
+			name:     "GoReleaserUniversal",
+			matcher:  GoReleaserMatcher,
+			platform: mac,
+			assets:   named("savvy_1.2.3_darwin_all.tar.gz", "savvy_1.2.3_darwin_arm64.tar.gz"),
+			want:     "savvy_1.2.3_darwin_arm64.tar.gz",
+		},
+		{
+			name:     "GoReleaserProjectWithUnderscores",
+			matcher:  GoReleaserMatcher,
+			platform: linux,
+			assets:   named("savvy_cli_1.2.3_linux_amd64.tar.gz"),
+			want:     "savvy_cli_1.2.3_linux_amd64.tar.gz",
+		},
+		{name: "RustGnu", matcher: RustTargetMatcher, platform: linux, assets: rustAssets, want: "savvy-v1.2.3-x86_64-unknown-linux-gnu.tar.gz"},
+		{name: "RustMusl", matcher: RustTargetMatcher, platform: musl, assets: rustAssets, want: "savvy-v1.2.3-x86_64-unknown-linux-musl.tar.gz"},
+		{
+			name:     "RustMuslOnGnu",
+			matcher:  RustTargetMatcher,
+			platform: linux,
+			assets:   named("savvy-v1.2.3-x86_64-unknown-linux-musl.tar.gz"),
+			want:     "savvy-v1.2.3-x86_64-unknown-linux-musl.tar.gz",
+		},
+		{name: "RustDarwin", matcher: RustTargetMatcher, platform: mac, assets: rustAssets, want: "savvy-v1.2.3-aarch64-apple-darwin.tar.gz"},
+		{name: "RustArm", matcher: RustTargetMatcher, platform: armv7, assets: rustAssets, want: "savvy-v1.2.3-armv7-unknown-linux-gnueabihf.tar.gz"},
+		{
+			name:     "RustWithoutVersion",
+			matcher:  RustTargetMatcher,
+			platform: linux,
+			assets:   named("savvy-aarch64-unknown-linux-gnu", "savvy-x86_64-unknown-linux-gnu"),
+			want:     "savvy-x86_64-unknown-linux-gnu",
+		},
+		{
+			name:     "Common",
+			matcher:  CommonMatcher,
+			platform: linux,
+			assets:   named("Savvy-Windows-64bit.exe", "Savvy-Linux-32bit", "Savvy-Linux-64bit"),
+			want:     "Savvy-Linux-64bit",
+		},
+		{
+			name:     "CommonWithVersion",
+			matcher:  CommonMatcher,
+			platform: mac,
+			assets:   named("savvy-v1.2.3-linux-arm64.zip", "savvy-v1.2.3-macos-arm64.zip"),
+			want:     "savvy-v1.2.3-macos-arm64.zip",
+		},
+		{
+			name:     "Template",
+			matcher:  template("savvy-{{.Version}}-{{.Arch}}-unknown-{{.OS}}-musl{{.Ext}}"),
+			platform: linux,
+			assets:   rustAssets,
+			want:     "savvy-v1.2.3-x86_64-unknown-linux-musl.tar.gz",
+		},
+		{
+			name:     "GoReleaserOtherVersions",
+			matcher:  GoReleaserMatcher,
+			platform: linux,
+			assets:   named("savvy_1.2.2_linux_amd64.tar.gz", "savvy_1.2.3_linux_amd64.tar.gz", "savvy_1.2.3-rc1_linux_amd64.tar.gz"),
+			want:     "savvy_1.2.3_linux_amd64.tar.gz",
+		},
+		{
+			name:     "TemplateOtherVersions",
+			matcher:  template("savvy-{{.Version}}-{{.OS}}-{{.Arch}}"),
+			platform: linux,
+			assets:   named("savvy-v1.2.30-linux-amd64", "savvy-1.2.3-linux-amd64"),
+			want:     "savvy-1.2.3-linux-amd64",
+		},
+		{
+			name:     "TemplateCaseInsensitive",
+			matcher:  template("{{.Name}}-{{.OS}}-{{.Arch}}"),
+			platform: linux,
+			assets:   named("Savvy-Linux-arm64", "Savvy-Linux-x64"),
+			want:     "Savvy-Linux-x64",
+		},
+		{
+			name:     "TemplatePrefersLongerAlias",
+			matcher:  template("savvy_{{.OS}}_{{.Arch}}"),
+			platform: armv7,
+			assets:   named("savvy_linux_arm", "savvy_linux_armv7"),
+			want:     "savvy_linux_armv7",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			asset, ok := tc.matcher.Match(tc.assets, "v1.2.3", tc.platform)
+			if assert.True(t, ok) {
+				assert.Equal(t, tc.want, asset.Name)
+			}
+		})
+	}
+
+	t.Run("NoMatch", func(t *testing.T) {
+		_, ok := GoReleaserMatcher.Match(named("savvy_1.2.3_windows_amd64.zip"), "1.2.3", linux)
+		assert.False(t, ok)
+		_, ok = template("savvy-{{.OS}}-{{.Arch}}").Match(named("savvy-linux-amd64.deb"), "1.2.3", linux)
+		assert.False(t, ok)
+		_, ok = RustTargetMatcher.Match(rustAssets, "v1.2.4", linux)
+		assert.False(t, ok)
+		// a gnu binary can't run on a musl system.
+		_, ok = RustTargetMatcher.Match(named("savvy-v1.2.3-x86_64-unknown-linux-gnu.tar.gz"), "v1.2.3", musl)
+		assert.False(t, ok)
+	})
+	t.Run("Regex", func(t *testing.T) {
+		m, err := NewRegexMatcher(`^savvy-(?P<os>[a-z]+)-(?P<arch>[a-z0-9_]+)\.pkg$`)
+		assert.NoError(t, err)
+		asset, ok := m.Match(named("savvy-linux-arm64.pkg", "savvy-linux-x86_64.pkg"), "1.2.3", linux)
+		assert.True(t, ok)
+		assert.Equal(t, "savvy-linux-x86_64.pkg", asset.Name)
+
+		_, err = NewRegexMatcher(`savvy-(`)
+		assert.Error(t, err)
+	})
+	t.Run("InvalidTemplate", func(t *testing.T) {
+		_, err := NewTemplateMatcher("savvy-{{.Platform}}")
+		assert.Error(t, err)
+	})
+}
+
+func TestDownloaderWithMatcher(t *testing.T) {
+	d := NewAssetDownloader("savvy", WithOS("linux"), WithArch("amd64"), WithMatcher(RustTargetMatcher)).(Selector)
+	asset, ok := d.SelectAsset(&release.Info{TagName: "v1.2.3", Assets: named(
+		"savvy-v1.2.2-x86_64-unknown-linux-gnu.tar.gz",
+		"savvy-v1.2.3-aarch64-unknown-linux-gnu.tar.gz",
+		"savvy-v1.2.3-x86_64-unknown-linux-gnu.tar.gz",
+	)})
+	assert.True(t, ok)
+	assert.Equal(t, "savvy-v1.2.3-x86_64-unknown-linux-gnu.tar.gz", asset.Name)
+}
@@ -5,17 +5,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/getsavvyinc/upgrade-cli/transport"
 )
 
 type Asset struct {
 	Name               string `json:"name"`
 	BrowserDownloadURL string `json:"browser_download_url"`
+	// Size is the size of the asset in bytes, as reported by GitHub.
+	Size int64 `json:"size"`
 }
 
 // Info holds information about a release.
 type Info struct {
-	TagName string  `json:"tag_name"`
-	Assets  []Asset `json:"assets"`
+	TagName string `json:"tag_name"`
+	// TargetCommitish is the branch or commit the release's tag was created from.
+	TargetCommitish string  `json:"target_commitish"`
+	Assets          []Asset `json:"assets"`
 }
 
 type Getter interface {
@@ -24,29 +30,44 @@ type Getter interface {
 
 type githubReleaseGetter struct {
 	repo, owner string
+	client      *http.Client
 }
 
 var _ Getter = (*githubReleaseGetter)(nil)
 
-func NewReleaseGetter(repo, owner string) *githubReleaseGetter {
-	return &githubReleaseGetter{
-		repo:  repo,
-		owner: owner,
+type GetterOpt func(*githubReleaseGetter)
+
+// WithHTTPClient sets the client used to talk to the GitHub API. It defaults to transport.NewClient.
+func WithHTTPClient(c *http.Client) GetterOpt {
+	return func(g *githubReleaseGetter) {
+		g.client = c
+	}
+}
+
+func NewReleaseGetter(repo, owner string, opts ...GetterOpt) *githubReleaseGetter {
+	g := &githubReleaseGetter{
+		repo:   repo,
+		owner:  owner,
+		client: transport.NewClient(),
+	}
+	for _, opt := range opts {
+		opt(g)
 	}
+	return g
 }
 
 func (g *githubReleaseGetter) GetLatestRelease(ctx context.Context) (*Info, error) {
 	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", g.owner, g.repo)
-	return getLatestRelease(ctx, url)
+	return getLatestRelease(ctx, g.client, url)
 }
 
 // getLatestRelease fetches the latest release from GitHub.
-func getLatestRelease(ctx context.Context, url string) (*Info, error) {
+func getLatestRelease(ctx context.Context, client *http.Client, url string) (*Info, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
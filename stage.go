@@ -0,0 +1,268 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/getsavvyinc/upgrade-cli/install"
+	"github.com/getsavvyinc/upgrade-cli/lock"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+	"github.com/hashicorp/go-version"
+)
+
+// ErrInvalidStagedUpgrade means a staged upgrade was discarded because its files were missing or
+// corrupted, or it doesn't match the upgrader's install plan.
+var ErrInvalidStagedUpgrade = errors.New("invalid staged upgrade")
+
+// stagedManifest is the name of the file describing a staged upgrade, in the staging directory.
+const stagedManifest = "manifest.json"
+
+// Stager downloads upgrades ahead of time, so that they can be installed quickly when the program next starts.
+//
+// A typical program calls Stage from a background goroutine or a scheduled job, and ApplyStaged early
+// in main, e.g followed by Reexec if an upgrade was applied.
+type Stager interface {
+	// Stage downloads and verifies the latest version, if it is newer than currentVersion, into the
+	// staging directory. It reports whether a version was staged.
+	Stage(ctx context.Context, currentVersion string) (bool, error)
+	// ApplyStaged installs the staged version, if any, and reports whether it was installed.
+	//
+	// It is cheap when nothing is staged. A staged version that isn't newer than currentVersion is
+	// discarded, as is one that fails validation, in which case an error wrapping
+	// ErrInvalidStagedUpgrade is returned.
+	ApplyStaged(ctx context.Context, currentVersion string) (bool, error)
+}
+
+var _ Stager = (*upgrader)(nil)
+
+// NewStager returns a Stager for the executable at executablePath. It accepts the same options as NewUpgrader.
+//
+// Staged upgrades are installed without privilege escalation: Stage fails with an error wrapping
+// install.ErrPermissionDenied if the user can't replace the installed files.
+//
+// Staged files are validated against the release's checksums when they are staged, and only checked
+// for corruption when they are applied. The staging directory must only be writable by the user.
+func NewStager(owner string, repo string, executablePath string, opts ...Opt) Stager {
+	return NewUpgrader(owner, repo, executablePath, opts...).(Stager)
+}
+
+// WithStagingDir sets the directory Stage keeps the next version in.
+//
+// It defaults to a directory in the user's cache directory that is specific to the executable. Anyone
+// who can write to the directory can change the version that is installed.
+func WithStagingDir(dir string) Opt {
+	return func(u *upgrader) {
+		u.stagingDir = dir
+	}
+}
+
+// stagedUpgrade describes the staged version and the files it installs.
+type stagedUpgrade struct {
+	Version        string        `json:"version"`
+	ExecutablePath string        `json:"executable_path"`
+	Release        *release.Info `json:"release,omitempty"`
+	Files          []stagedFile  `json:"files"`
+}
+
+type stagedFile struct {
+	// Name is the name of the file in the staging directory.
+	Name   string      `json:"name"`
+	Target string      `json:"target"`
+	Mode   os.FileMode `json:"mode,omitempty"`
+	// SHA256 is the hex encoded digest of the file when it was staged. It detects corruption, e.g a
+	// truncated file, but not tampering, since it is stored next to the file.
+	SHA256 string `json:"sha256"`
+}
+
+// stagingDirectory returns the directory upgrades of the executable are staged in.
+func (u *upgrader) stagingDirectory() string {
+	if u.stagingDir != "" {
+		return u.stagingDir
+	}
+	sum := sha256.Sum256([]byte(u.installPath))
+	return filepath.Join(asset.DefaultFallbackDir(), "staged", hex.EncodeToString(sum[:8]))
+}
+
+func (u *upgrader) Stage(ctx context.Context, currentVersion string) (bool, error) {
+	if _, err := version.NewVersion(currentVersion); err != nil {
+		return false, err
+	}
+
+	l, err := lock.Acquire(ctx, u.installPath, u.lockTimeout)
+	if err != nil {
+		return false, err
+	}
+	defer l.Release()
+
+	if err := recoverInterrupted(u.installPath); err != nil {
+		return false, err
+	}
+	_ = u.sweep()
+
+	upd, err := u.prepare(ctx, currentVersion, false)
+	if err != nil || upd == nil {
+		return false, err
+	}
+	defer upd.cleanup()
+
+	dir := u.stagingDirectory()
+	// a previously staged version is replaced by the newer one.
+	if err := os.RemoveAll(dir); err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return false, err
+	}
+	if err := writeStaged(dir, upd); err != nil {
+		os.RemoveAll(dir)
+		return false, fmt.Errorf("failed to stage %s: %w", upd.hookInfo.ToVersion, err)
+	}
+	return true, nil
+}
+
+// writeStaged moves the files of upd into dir and records them in its manifest.
+//
+// The manifest is written last, so a partially staged upgrade is never applied.
+func writeStaged(dir string, upd *update) error {
+	staged := stagedUpgrade{
+		Version:        upd.hookInfo.ToVersion,
+		ExecutablePath: upd.hookInfo.ExecutablePath,
+		Release:        upd.hookInfo.Release,
+	}
+	for i, item := range upd.items {
+		name := strconv.Itoa(i)
+		path := filepath.Join(dir, name)
+		if err := install.Move(item.Source, path); err != nil {
+			return err
+		}
+		digest, err := sha256File(path)
+		if err != nil {
+			return err
+		}
+		staged.Files = append(staged.Files, stagedFile{Name: name, Target: item.Target, Mode: item.Mode, SHA256: digest})
+	}
+
+	data, err := json.Marshal(staged)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, stagedManifest+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return install.Move(tmp, filepath.Join(dir, stagedManifest))
+}
+
+func (u *upgrader) ApplyStaged(ctx context.Context, currentVersion string) (bool, error) {
+	curr, err := version.NewVersion(currentVersion)
+	if err != nil {
+		return false, err
+	}
+
+	// most starts have nothing to apply, so check without locking first.
+	dir := u.stagingDirectory()
+	if _, err := os.Stat(filepath.Join(dir, stagedManifest)); errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	l, err := lock.Acquire(ctx, u.installPath, u.lockTimeout)
+	if err != nil {
+		return false, err
+	}
+	defer l.Release()
+
+	if err := recoverInterrupted(u.installPath); err != nil {
+		return false, err
+	}
+
+	staged, err := readStaged(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		// another process applied it while we were waiting for the lock.
+		return false, nil
+	}
+	// whatever happens next, the staged upgrade is only ever tried once.
+	defer os.RemoveAll(dir)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrInvalidStagedUpgrade, err)
+	}
+
+	next, err := version.NewVersion(staged.Version)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrInvalidStagedUpgrade, err)
+	}
+	if next.LessThanOrEqual(curr) {
+		return false, nil
+	}
+
+	// the files are installed where the install plan says, never where the manifest says.
+	plan := u.installPlan(u.installPath)
+	if staged.ExecutablePath != u.installPath || len(staged.Files) != len(plan) {
+		return false, fmt.Errorf("%w: staged for another install plan", ErrInvalidStagedUpgrade)
+	}
+	items := make([]install.Item, 0, len(plan))
+	for i, a := range plan {
+		f := staged.Files[i]
+		if f.Target != a.Destination || f.Mode != a.Mode {
+			return false, fmt.Errorf("%w: %s was staged for %s", ErrInvalidStagedUpgrade, f.Name, f.Target)
+		}
+		path := filepath.Join(dir, f.Name)
+		if filepath.Dir(path) != filepath.Clean(dir) {
+			return false, fmt.Errorf("%w: %s is outside the staging directory", ErrInvalidStagedUpgrade, f.Name)
+		}
+		digest, err := sha256File(path)
+		if err != nil {
+			return false, fmt.Errorf("%w: %w", ErrInvalidStagedUpgrade, err)
+		}
+		if digest != f.SHA256 {
+			return false, fmt.Errorf("%w: %s is corrupted", ErrInvalidStagedUpgrade, a.Destination)
+		}
+		items = append(items, install.Item{Source: path, Target: a.Destination, Mode: a.Mode})
+	}
+
+	hookInfo := HookInfo{
+		FromVersion:    currentVersion,
+		ToVersion:      staged.Version,
+		ExecutablePath: u.installPath,
+		Release:        staged.Release,
+	}
+	if err := u.replaceBinary(ctx, items, hookInfo); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func readStaged(dir string) (*stagedUpgrade, error) {
+	data, err := os.ReadFile(filepath.Join(dir, stagedManifest))
+	if err != nil {
+		return nil, err
+	}
+	var staged stagedUpgrade
+	if err := json.Unmarshal(data, &staged); err != nil {
+		return nil, err
+	}
+	return &staged, nil
+}
+
+// sha256File returns the hex encoded sha256 digest of the file at path.
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
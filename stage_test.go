@@ -0,0 +1,120 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStagedUpgrade(t *testing.T) {
+	ctx := context.Background()
+
+	// setup returns a stager for an executable containing "old", whose latest release is v0.2.0.
+	setup := func(t *testing.T, opts ...Opt) (string, string, Stager) {
+		stagingDir := filepath.Join(t.TempDir(), "staged")
+		executable, u := newTestUpgrader(t, "old", append([]Opt{WithStagingDir(stagingDir)}, opts...)...)
+		return executable, stagingDir, u
+	}
+
+	t.Run("NothingStaged", func(t *testing.T) {
+		executable, _, s := setup(t)
+		applied, err := s.ApplyStaged(ctx, "0.1.0")
+		assert.NoError(t, err)
+		assert.False(t, applied)
+		assertContent(t, executable, "old")
+	})
+	t.Run("StageAndApply", func(t *testing.T) {
+		var info HookInfo
+		executable, stagingDir, s := setup(t, WithPostUpgradeHook(func(ctx context.Context, i HookInfo) error {
+			info = i
+			return nil
+		}))
+		staged, err := s.Stage(ctx, "0.1.0")
+		assert.NoError(t, err)
+		assert.True(t, staged)
+		// staging doesn't touch the executable, or leave the download behind.
+		assertContent(t, executable, "old")
+		assertOnlyExecutable(t, executable)
+
+		applied, err := s.ApplyStaged(ctx, "0.1.0")
+		assert.NoError(t, err)
+		assert.True(t, applied)
+		assertContent(t, executable, "new")
+		assert.Equal(t, "0.1.0", info.FromVersion)
+		assert.Equal(t, "v0.2.0", info.ToVersion)
+		assert.NoDirExists(t, stagingDir)
+	})
+	t.Run("NoNewerVersion", func(t *testing.T) {
+		_, stagingDir, s := setup(t)
+		staged, err := s.Stage(ctx, "0.2.0")
+		assert.NoError(t, err)
+		assert.False(t, staged)
+		assert.NoDirExists(t, stagingDir)
+	})
+	t.Run("Stale", func(t *testing.T) {
+		executable, stagingDir, s := setup(t)
+		_, err := s.Stage(ctx, "0.1.0")
+		assert.NoError(t, err)
+
+		// the program was upgraded some other way since.
+		applied, err := s.ApplyStaged(ctx, "0.2.0")
+		assert.NoError(t, err)
+		assert.False(t, applied)
+		assertContent(t, executable, "old")
+		assert.NoDirExists(t, stagingDir)
+	})
+
+	// the staged upgrade is tampered with before it is applied.
+	invalid := []struct {
+		name   string
+		tamper func(t *testing.T, stagingDir string)
+	}{
+		{
+			name: "Corrupted",
+			tamper: func(t *testing.T, stagingDir string) {
+				assert.NoError(t, os.WriteFile(filepath.Join(stagingDir, "0"), []byte("ne"), 0755))
+			},
+		},
+		{
+			name: "OtherTarget",
+			tamper: func(t *testing.T, stagingDir string) {
+				staged, err := readStaged(stagingDir)
+				assert.NoError(t, err)
+				staged.Files[0].Target = filepath.Join(t.TempDir(), "other")
+				data, err := json.Marshal(staged)
+				assert.NoError(t, err)
+				assert.NoError(t, os.WriteFile(filepath.Join(stagingDir, stagedManifest), data, 0600))
+			},
+		},
+		{
+			name: "OutsideStagingDir",
+			tamper: func(t *testing.T, stagingDir string) {
+				staged, err := readStaged(stagingDir)
+				assert.NoError(t, err)
+				staged.Files[0].Name = filepath.Join("..", "0")
+				data, err := json.Marshal(staged)
+				assert.NoError(t, err)
+				assert.NoError(t, os.WriteFile(filepath.Join(stagingDir, stagedManifest), data, 0600))
+			},
+		},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			executable, stagingDir, s := setup(t)
+			_, err := s.Stage(ctx, "0.1.0")
+			assert.NoError(t, err)
+			tc.tamper(t, stagingDir)
+
+			applied, err := s.ApplyStaged(ctx, "0.1.0")
+			assert.ErrorIs(t, err, ErrInvalidStagedUpgrade)
+			assert.False(t, applied)
+			assertContent(t, executable, "old")
+			assertOnlyExecutable(t, executable)
+			assert.NoDirExists(t, stagingDir)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrInsecureScheme means a request or redirect did not use https.
+	ErrInsecureScheme = errors.New("insecure scheme")
+	// ErrHostNotAllowed means a request or redirect targeted a host outside the allowlist.
+	ErrHostNotAllowed = errors.New("host not allowed")
+	// ErrTooManyRedirects means a request was redirected more than the policy allows.
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// DefaultAllowedHosts are the hosts GitHub serves the release API and release assets from.
+var DefaultAllowedHosts = []string{
+	"api.github.com",
+	"github.com",
+	"objects.githubusercontent.com",
+	"release-assets.githubusercontent.com",
+}
+
+// PolicyError describes a request that violated the transport policy.
+type PolicyError struct {
+	// Err is one of ErrInsecureScheme, ErrHostNotAllowed or ErrTooManyRedirects.
+	Err error
+	URL string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err, e.URL)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+type policy struct {
+	allowedHosts []string
+	maxRedirects int
+	base         http.RoundTripper
+}
+
+type Opt func(*policy)
+
+// WithAllowedHosts replaces DefaultAllowedHosts.
+//
+// A host may start with "*." to allow all of its subdomains, e.g *.githubusercontent.com.
+func WithAllowedHosts(hosts ...string) Opt {
+	return func(p *policy) {
+		p.allowedHosts = hosts
+	}
+}
+
+// WithMaxRedirects limits the number of redirects that are followed. It defaults to 10.
+func WithMaxRedirects(n int) Opt {
+	return func(p *policy) {
+		p.maxRedirects = n
+	}
+}
+
+// WithBaseTransport sets the transport requests are sent with once they pass the policy.
+// It defaults to http.DefaultTransport.
+func WithBaseTransport(rt http.RoundTripper) Opt {
+	return func(p *policy) {
+		p.base = rt
+	}
+}
+
+// NewClient returns an http.Client that only talks to the allowed hosts over https,
+// including when following redirects.
+func NewClient(opts ...Opt) *http.Client {
+	p := &policy{
+		allowedHosts: DefaultAllowedHosts,
+		maxRedirects: 10,
+		base:         http.DefaultTransport,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return &http.Client{
+		Transport:     p,
+		CheckRedirect: p.checkRedirect,
+	}
+}
+
+// RoundTrip enforces the policy on every request, which includes each hop of a redirect.
+func (p *policy) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := p.check(req); err != nil {
+		return nil, err
+	}
+	return p.base.RoundTrip(req)
+}
+
+func (p *policy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > p.maxRedirects {
+		return &PolicyError{Err: ErrTooManyRedirects, URL: req.URL.Redacted()}
+	}
+	return p.check(req)
+}
+
+func (p *policy) check(req *http.Request) error {
+	if req.URL.Scheme != "https" {
+		return &PolicyError{Err: ErrInsecureScheme, URL: req.URL.Redacted()}
+	}
+	if !p.isAllowed(req.URL.Hostname()) {
+		return &PolicyError{Err: ErrHostNotAllowed, URL: req.URL.Redacted()}
+	}
+	return nil
+}
+
+func (p *policy) isAllowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range p.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok && strings.HasSuffix(host, suffix) {
+			return true
+		}
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
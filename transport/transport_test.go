@@ -0,0 +1,85 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("plain http server should never be called: %s", r.URL)
+	}))
+	t.Cleanup(plain.Close)
+
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/redirect/self", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/redirect/http", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL+"/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/redirect/host", func(w http.ResponseWriter, r *http.Request) {
+		// localhost resolves to the same server, but is not on the allowlist.
+		http.Redirect(w, r, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)+"/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/redirect/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/redirect/loop", http.StatusFound)
+	})
+
+	client := NewClient(WithAllowedHosts("127.0.0.1"), WithBaseTransport(srv.Client().Transport), WithMaxRedirects(3))
+	get := func(url string) error {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+		assert.NoError(t, err)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	testCases := []struct {
+		name string
+		url  string
+		err  error
+	}{
+		{name: "Allowed", url: srv.URL + "/ok"},
+		{name: "RedirectToAllowedHost", url: srv.URL + "/redirect/self"},
+		{name: "PlainHTTP", url: plain.URL + "/ok", err: ErrInsecureScheme},
+		{name: "RedirectToPlainHTTP", url: srv.URL + "/redirect/http", err: ErrInsecureScheme},
+		{name: "RedirectToOtherHost", url: srv.URL + "/redirect/host", err: ErrHostNotAllowed},
+		{name: "TooManyRedirects", url: srv.URL + "/redirect/loop", err: ErrTooManyRedirects},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := get(tc.url)
+			if tc.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.err)
+			var perr *PolicyError
+			assert.ErrorAs(t, err, &perr)
+		})
+	}
+}
+
+func TestIsAllowed(t *testing.T) {
+	p := &policy{allowedHosts: []string{"github.com", "*.githubusercontent.com"}}
+	assert.True(t, p.isAllowed("github.com"))
+	assert.True(t, p.isAllowed("GitHub.com"))
+	assert.True(t, p.isAllowed("objects.githubusercontent.com"))
+	assert.False(t, p.isAllowed("githubusercontent.com"))
+	assert.False(t, p.isAllowed("evilgithub.com"))
+	assert.False(t, p.isAllowed("github.com.evil.com"))
+}
@@ -4,12 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
+	"github.com/getsavvyinc/upgrade-cli/archive"
 	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/install"
+	"github.com/getsavvyinc/upgrade-cli/lock"
+	"github.com/getsavvyinc/upgrade-cli/platform"
 	"github.com/getsavvyinc/upgrade-cli/release"
 	"github.com/getsavvyinc/upgrade-cli/release/asset"
+	"github.com/getsavvyinc/upgrade-cli/transport"
+	"github.com/getsavvyinc/upgrade-cli/verify"
 	"github.com/hashicorp/go-version"
 )
 
@@ -21,12 +30,29 @@ type Upgrader interface {
 
 type upgrader struct {
 	executablePath     string
+	installPath        string
 	repo               string
 	owner              string
 	releaseGetter      release.Getter
 	assetDownloader    asset.Downloader
 	checksumDownloader checksum.Downloader
 	checksumValidator  checksum.CheckSumValidator
+	platform           platform.Platform
+	verifiers          []verify.Verifier
+	skipFormatCheck    bool
+	allowManaged       bool
+	escalate           bool
+	lockTimeout        time.Duration
+	plan               []Artifact
+	hooks              []Hook
+	keepOnHookFailure  bool
+	stagingDir         string
+	skipPatches        bool
+	assetMatcher       asset.Matcher
+	// privilegedDownloader downloads to a directory the user can write to, when the install
+	// directory isn't writable and privilege escalation is enabled.
+	privilegedDownloader asset.Downloader
+	httpClient           *http.Client
 }
 
 var _ Upgrader = (*upgrader)(nil)
@@ -51,26 +77,132 @@ func WithCheckSumValidator(c checksum.CheckSumValidator) Opt {
 	}
 }
 
+// WithPlatform sets the platform to upgrade for. It defaults to platform.Current.
+func WithPlatform(p platform.Platform) Opt {
+	return func(u *upgrader) {
+		u.platform = p
+	}
+}
+
+// WithVerifier adds a verification step that must pass before the downloaded binary is installed.
+//
+// Verifiers run in the order they were added, after the checksum has been validated.
+func WithVerifier(v verify.Verifier) Opt {
+	return func(u *upgrader) {
+		u.verifiers = append(u.verifiers, v)
+	}
+}
+
+// WithoutFormatCheck disables checking that the downloaded binary is an executable for the target platform.
+func WithoutFormatCheck() Opt {
+	return func(u *upgrader) {
+		u.skipFormatCheck = true
+	}
+}
+
+// WithHTTPClient sets the client used for every request made during the upgrade.
+//
+// It defaults to transport.NewClient, which only allows https requests to GitHub.
+func WithHTTPClient(c *http.Client) Opt {
+	return func(u *upgrader) {
+		u.httpClient = c
+	}
+}
+
+// WithAssetMatcher selects the asset to download with m, e.g asset.GoReleaserMatcher, instead of
+// matching URLs by their $os_$arch suffix. It has no effect if WithAssetDownloader is used.
+//
+// The presets match archives, from which the executable is extracted unless WithInstallPlan is used.
+func WithAssetMatcher(m asset.Matcher) Opt {
+	return func(u *upgrader) {
+		u.assetMatcher = m
+	}
+}
+
+// WithAllowManagedInstall allows upgrading an executable that was installed by a package manager,
+// e.g Homebrew or dpkg. By default Upgrade returns an error wrapping install.ErrManagedInstall.
+func WithAllowManagedInstall() Opt {
+	return func(u *upgrader) {
+		u.allowManaged = true
+	}
+}
+
+// WithPrivilegeEscalation allows installing into a directory the current user can't write to.
+//
+// The binary is still downloaded and verified as the current user; only the final install step runs
+// through sudo or doas, which may prompt for a password. Without it, Upgrade returns an error wrapping
+// install.ErrPermissionDenied.
+//
+// The privileged install step can't be rolled back, so install plans with more than one artifact
+// fail with an error wrapping ErrPlanNotEscalatable instead, and upgrades with post-upgrade hooks
+// with an error wrapping ErrHooksNotEscalatable unless WithoutRollbackOnHookFailure is used.
+func WithPrivilegeEscalation() Opt {
+	return func(u *upgrader) {
+		u.escalate = true
+	}
+}
+
+// WithLockTimeout sets how long Upgrade waits for another upgrade of the same executable to finish.
+//
+// It defaults to zero, so Upgrade fails immediately with an error wrapping lock.ErrUpgradeInProgress.
+func WithLockTimeout(d time.Duration) Opt {
+	return func(u *upgrader) {
+		u.lockTimeout = d
+	}
+}
+
+// NewUpgrader returns an Upgrader for the executable at executablePath.
+//
+// If executablePath is a symlink, the file it points to is upgraded.
 func NewUpgrader(owner string, repo string, executablePath string, opts ...Opt) Upgrader {
 	u := &upgrader{
 		repo:           repo,
 		owner:          owner,
 		executablePath: executablePath,
-		releaseGetter:  release.NewReleaseGetter(repo, owner),
-		assetDownloader: asset.NewAssetDownloader(executablePath, asset.WithLookupArchFallback(map[string][]string{
-			"amd64": {"x86_64"},
-			"386":   {"i86", "all"},
-			"arm64": {"all"},
-		})),
-		checksumDownloader: checksum.NewCheckSumDownloader(),
-		checksumValidator:  checksum.NewCheckSumValidator(),
+		installPath:    install.ResolvePath(executablePath),
+		platform:       platform.Current(),
+		httpClient:     transport.NewClient(),
 	}
 	for _, opt := range opts {
 		opt(u)
 	}
+
+	// the format check runs first so that other verifiers never execute a binary built for another platform.
+	if !u.skipFormatCheck {
+		u.verifiers = append([]verify.Verifier{verify.NewFormatVerifier()}, u.verifiers...)
+	}
+
+	// asset selection and checksum validation must agree on the platform, and every request must go
+	// through the same client, so the defaults are built after the options have been applied.
+	u.releaseGetter = release.NewReleaseGetter(repo, owner, release.WithHTTPClient(u.httpClient))
+	if u.escalate {
+		// a custom downloader is used as is, but the default one downloads next to the executable.
+		u.privilegedDownloader = u.assetDownloader
+		if u.privilegedDownloader == nil {
+			u.privilegedDownloader = u.newAssetDownloader(asset.WithDownloadDir(os.TempDir()))
+		}
+	}
+	if u.assetDownloader == nil {
+		u.assetDownloader = u.newAssetDownloader()
+	}
+	if u.checksumDownloader == nil {
+		u.checksumDownloader = checksum.NewCheckSumDownloader(checksum.WithHTTPClient(u.httpClient))
+	}
+	if u.checksumValidator == nil {
+		u.checksumValidator = checksum.NewCheckSumValidator(checksum.WithPlatform(u.platform))
+	}
 	return u
 }
 
+// newAssetDownloader returns the default asset downloader, configured by the upgrader's options.
+func (u *upgrader) newAssetDownloader(opts ...asset.AssetDownloadOpt) asset.Downloader {
+	opts = append([]asset.AssetDownloadOpt{asset.WithPlatform(u.platform), asset.WithHTTPClient(u.httpClient)}, opts...)
+	if u.assetMatcher != nil {
+		opts = append(opts, asset.WithMatcher(u.assetMatcher))
+	}
+	return asset.NewAssetDownloader(u.installPath, opts...)
+}
+
 var ErrInvalidCheckSum = errors.New("invalid checksum")
 
 func (u *upgrader) IsNewVersionAvailable(ctx context.Context, currentVersion string) (bool, error) {
@@ -93,61 +225,336 @@ func (u *upgrader) IsNewVersionAvailable(ctx context.Context, currentVersion str
 }
 
 func (u *upgrader) Upgrade(ctx context.Context, currentVersion string) error {
-	curr, err := version.NewVersion(currentVersion)
+	if _, err := version.NewVersion(currentVersion); err != nil {
+		return err
+	}
+
+	// the whole upgrade holds the lock, so concurrent upgrades never download or replace the binary at the same time.
+	l, err := lock.Acquire(ctx, u.installPath, u.lockTimeout)
 	if err != nil {
 		return err
 	}
+	defer l.Release()
+
+	// a previous upgrade may have been interrupted while replacing the binary.
+	if err := recoverInterrupted(u.installPath); err != nil {
+		return err
+	}
+	// or before removing its temporary files. Failing to remove them doesn't prevent the upgrade.
+	_ = u.sweep()
+
+	upd, err := u.prepare(ctx, currentVersion, u.escalate)
+	if err != nil || upd == nil {
+		return err
+	}
+	defer upd.cleanup()
+
+	if upd.escalator != "" {
+		// prepare only escalates single file plans, and hooks whose failure keeps the new version.
+		if err := install.ReplacePrivileged(ctx, upd.escalator, upd.items[0]); err != nil {
+			return err
+		}
+		return u.runHooks(ctx, upd.hookInfo)
+	}
+	return u.replaceBinary(ctx, upd.items, upd.hookInfo)
+}
+
+// update is a downloaded and verified release, ready to be installed.
+type update struct {
+	items    []install.Item
+	hookInfo HookInfo
+	// escalator is the command the items must be installed with, if the user can't replace them.
+	escalator string
+	// cleanup removes the downloaded files that weren't installed.
+	cleanup func()
+}
+
+// prepare downloads and verifies the latest release if it is newer than currentVersion. It returns a
+// nil update if there is no newer version.
+//
+// If escalate is false, an error wrapping install.ErrPermissionDenied is returned when a file in the
+// install plan can't be replaced by the user.
+func (u *upgrader) prepare(ctx context.Context, currentVersion string, escalate bool) (*update, error) {
+	curr, err := version.NewVersion(currentVersion)
+	if err != nil {
+		return nil, err
+	}
 
 	releaseInfo, err := u.releaseGetter.GetLatestRelease(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	latest, err := version.NewVersion(releaseInfo.TagName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if latest.LessThanOrEqual(curr) {
-		return nil
+		return nil, nil
+	}
+
+	// replacing an executable owned by a package manager would corrupt the package manager's state.
+	inst, err := install.Detect(ctx, u.executablePath)
+	if err != nil {
+		return nil, err
+	}
+	if !u.allowManaged {
+		if err := inst.Err(); err != nil {
+			return nil, err
+		}
 	}
 
-	// from the releaseInfo, download the binary for the architecture
+	// check every file can be replaced before downloading anything.
+	plan := u.installPlan(inst.Path)
+	if !slices.ContainsFunc(plan, func(a Artifact) bool { return a.Destination == inst.Path }) {
+		return nil, fmt.Errorf("%w: %s", ErrNoExecutableInPlan, inst.Path)
+	}
+	downloader, escalator := u.assetDownloader, ""
+	for _, a := range plan {
+		err := install.CheckWritable(a.Destination)
+		if err == nil || escalator != "" {
+			continue
+		}
+		if !escalate || !errors.Is(err, install.ErrPermissionDenied) {
+			return nil, err
+		}
+		// each privileged install replaces a single file, so a plan couldn't be installed atomically.
+		if len(plan) > 1 {
+			return nil, fmt.Errorf("%w: %w", ErrPlanNotEscalatable, err)
+		}
+		// nor could the previous version be restored if a hook failed.
+		if len(u.hooks) > 0 && !u.keepOnHookFailure {
+			return nil, fmt.Errorf("%w: %w", ErrHooksNotEscalatable, err)
+		}
+		if escalator, err = install.FindEscalator(); err != nil {
+			return nil, err
+		}
+		downloader = u.privilegedDownloader
+	}
 
-	downloadInfo, cleanup, err := u.assetDownloader.DownloadAsset(ctx, releaseInfo.Assets)
+	// patch the current binary if the release has a patch for it, since patches are much smaller.
+	upd := &update{escalator: escalator}
+	downloadInfo, cleanup, err := u.downloadPatched(ctx, currentVersion, inst.Path, releaseInfo, downloader)
+	if err == nil {
+		err = u.verifyUpdate(ctx, upd, plan, inst.Path, releaseInfo, downloadInfo, cleanup, downloader)
+		// the patched binary is verified like a full download, so other errors, e.g a failed verifier,
+		// would fail a full download too.
+		if err != nil && !errors.Is(err, ErrInvalidCheckSum) {
+			return nil, err
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+	if err != nil {
+		// there is no patch, it couldn't be downloaded or applied, or it didn't produce the released
+		// binary, e.g because the executable was modified, so download the binary for the architecture instead.
+		downloadInfo, cleanup, err = downloadRelease(ctx, downloader, releaseInfo)
+		if err != nil {
+			return nil, err
+		}
+		if err := u.verifyUpdate(ctx, upd, plan, inst.Path, releaseInfo, downloadInfo, cleanup, downloader); err != nil {
+			return nil, err
+		}
+	}
+
+	upd.hookInfo = HookInfo{
+		FromVersion:    currentVersion,
+		ToVersion:      releaseInfo.TagName,
+		ExecutablePath: inst.Path,
+		Release:        releaseInfo,
+	}
+	return upd, nil
+}
+
+// downloadRelease downloads the asset of releaseInfo for the platform, passing the whole release to
+// downloaders that match asset names against its version.
+func downloadRelease(ctx context.Context, downloader asset.Downloader, releaseInfo *release.Info) (*asset.Info, func() error, error) {
+	if d, ok := downloader.(asset.ReleaseDownloader); ok {
+		return d.DownloadRelease(ctx, releaseInfo)
+	}
+	return downloader.DownloadAsset(ctx, releaseInfo.Assets)
+}
+
+// verifyUpdate validates the downloaded asset's checksum, then stages the files in plan into upd and
+// runs the verifiers on the one installed at executablePath.
+//
+// cleanup removes the downloaded asset. If an error is returned, every downloaded file has been removed.
+func (u *upgrader) verifyUpdate(ctx context.Context, upd *update, plan []Artifact, executablePath string, releaseInfo *release.Info, downloadInfo *asset.Info, cleanup func() error, downloader asset.Downloader) (err error) {
+	upd.items = nil
+	upd.cleanup = func() {
+		removeSources(upd.items)
+		if cleanup != nil {
+			cleanup()
+		}
+	}
+	defer func() {
+		if err != nil {
+			upd.cleanup()
+		}
+	}()
+
+	// download the checksum file(s) for the downloaded asset
+	checksumInfo, err := u.downloadChecksums(ctx, downloadInfo.Asset, releaseInfo.Assets)
 	if err != nil {
 		return err
 	}
 
-	if cleanup != nil {
-		defer cleanup()
+	// pick the digest matching the algorithm used by the checksum file
+	downloadedChecksum, ok := downloadInfo.Digest(checksumInfo.Algorithm)
+	if !ok {
+		return fmt.Errorf("%w: no %s digest for downloaded asset", ErrInvalidCheckSum, checksumInfo.Algorithm)
 	}
 
-	// download the checksum file
-	checksumInfo, err := u.checksumDownloader.Download(ctx, releaseInfo.Assets)
+	// verify the checksum
+	if err := u.validateChecksum(ctx, downloadInfo.Asset, checksumInfo, downloadedChecksum); err != nil {
+		return err
+	}
+
+	// extract and download the other files in the install plan
+	plan = u.assetPlan(plan, executablePath, downloadInfo.Asset.Name)
+	upd.items, err = u.stagePlan(ctx, plan, releaseInfo, downloadInfo, downloader)
+	if len(u.plan) == 0 && errors.Is(err, archive.ErrMemberNotFound) {
+		return fmt.Errorf("%w: %w", ErrNoExecutableInArchive, err)
+	}
 	if err != nil {
 		return err
 	}
 
+	for _, item := range upd.items {
+		if item.Target != executablePath {
+			continue
+		}
+		candidate := verify.Candidate{
+			Path:     item.Source,
+			Version:  releaseInfo.TagName,
+			Platform: u.platform,
+			Release:  releaseInfo,
+		}
+		for _, v := range u.verifiers {
+			if err := v.Verify(ctx, candidate); err != nil {
+				return fmt.Errorf("failed to verify %s: %w", releaseInfo.TagName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// downloadChecksums prefers resolving the checksums for target when the checksum downloader supports it.
+func (u *upgrader) downloadChecksums(ctx context.Context, target release.Asset, assets []release.Asset) (*checksum.Info, error) {
+	if r, ok := u.checksumDownloader.(checksum.Resolver); ok {
+		return r.Resolve(ctx, target, assets)
+	}
+	return u.checksumDownloader.Download(ctx, assets)
+}
+
+// validateChecksum returns an error wrapping ErrInvalidCheckSum if downloadedChecksum is invalid.
+//
+// If the validator can explain the failure, its error is wrapped too.
+func (u *upgrader) validateChecksum(ctx context.Context, target release.Asset, checksumInfo *checksum.Info, downloadedChecksum string) error {
 	executableName := filepath.Base(u.executablePath)
-	// verify the checksum
-	if !u.checksumValidator.IsCheckSumValid(ctx, executableName, checksumInfo, downloadInfo.Checksum) {
+	if v, ok := u.checksumValidator.(checksum.Validator); ok {
+		if err := v.Validate(ctx, target, executableName, checksumInfo, downloadedChecksum); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidCheckSum, err)
+		}
+		return nil
+	}
+	if v, ok := u.checksumValidator.(checksum.AssetValidator); ok {
+		if !v.IsAssetCheckSumValid(ctx, target, executableName, checksumInfo, downloadedChecksum) {
+			return ErrInvalidCheckSum
+		}
+		return nil
+	}
+	if !u.checksumValidator.IsCheckSumValid(ctx, executableName, checksumInfo, downloadedChecksum) {
 		return ErrInvalidCheckSum
 	}
+	return nil
+}
 
-	if err := replaceBinary(downloadInfo.DownloadedBinaryFilePath, u.executablePath); err != nil {
-		return fmt.Errorf("failed to replace binary: %w", err)
+// Recover finishes or undoes an upgrade of the binary at executablePath that was interrupted,
+// e.g because the process was killed while the binary was being replaced.
+//
+// Upgrade calls Recover before upgrading. Programs may also call it on start up so that an
+// interrupted upgrade never leaves a backup of the previous binary behind.
+//
+// Recover does nothing if the executable is being upgraded, e.g by the process that runs the new
+// version's migration hook, since that upgrade isn't interrupted.
+func Recover(executablePath string) error {
+	installPath := install.ResolvePath(executablePath)
+	l, err := lock.Acquire(context.Background(), installPath, 0)
+	if errors.Is(err, lock.ErrUpgradeInProgress) {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
+	defer l.Release()
+	return recoverInterrupted(installPath)
+}
 
+// recoverInterrupted recovers an interrupted upgrade of installPath. Callers must hold the lock.
+func recoverInterrupted(installPath string) error {
+	if err := install.Recover(installPath); err != nil {
+		return fmt.Errorf("failed to recover interrupted upgrade: %w", err)
+	}
 	return nil
 }
 
-// replaceBinary replaces the current executable with the downloaded update.
-func replaceBinary(tmpFilePath, currentBinaryPath string) error {
-	// Replace the current binary with the new binary
-	if err := os.Rename(tmpFilePath, currentBinaryPath); err != nil {
+// Cleanup removes temporary files left behind by interrupted upgrades of the executable at executablePath.
+//
+// Only files older than install.DefaultStaleAge are removed. Upgrade cleans up before upgrading, so
+// Cleanup is only needed by programs that want to clean up without upgrading. Pass the upgrader's
+// WithInstallPlan option so that the directories of the other files it installs are cleaned up too.
+// It returns an error wrapping lock.ErrUpgradeInProgress if the executable is being upgraded.
+func Cleanup(ctx context.Context, executablePath string, opts ...Opt) error {
+	u := &upgrader{installPath: install.ResolvePath(executablePath)}
+	for _, opt := range opts {
+		opt(u)
+	}
+	l, err := lock.Acquire(ctx, u.installPath, 0)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	return u.sweep()
+}
+
+// sweep removes stale temporary files from every directory an upgrade creates them in, including
+// the directory of every file in the install plan.
+func (u *upgrader) sweep() error {
+	dirs := []string{asset.DefaultFallbackDir(), os.TempDir()}
+	for _, a := range u.installPlan(u.installPath) {
+		if dir := filepath.Dir(a.Destination); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return install.Sweep(u.installPath, dirs, install.DefaultStaleAge)
+}
+
+// replaceBinary replaces the current executable, and any other files in the install plan, with the
+// downloaded update and runs the post-upgrade hooks.
+//
+// The replaced files are backed up and restored if the update can't be installed, or if a hook fails
+// unless WithoutRollbackOnHookFailure was used.
+func (u *upgrader) replaceBinary(ctx context.Context, items []install.Item, hookInfo HookInfo) error {
+	tx := install.NewTransaction(u.installPath, items...)
+	if !u.keepOnHookFailure {
+		// hooks run after Apply, so an upgrade interrupted while they run is rolled back like a failed hook.
+		tx.RollbackUnlessCommitted()
+	}
+	if err := tx.Apply(); err != nil {
 		return fmt.Errorf("failed to replace binary: %w", err)
 	}
 
-	return nil
+	if err := u.runHooks(ctx, hookInfo); err != nil {
+		if u.keepOnHookFailure {
+			return errors.Join(err, tx.Commit())
+		}
+		if rerr := tx.Rollback(); rerr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restore previous version: %w", rerr))
+		}
+		return err
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,64 @@
+package upgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/install"
+	"github.com/getsavvyinc/upgrade-cli/lock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecover(t *testing.T) {
+	// interrupt applies a transaction replacing the executable without committing it, as if the
+	// upgrade was killed before removing the backup.
+	interrupt := func(t *testing.T) string {
+		dir := t.TempDir()
+		executable := filepath.Join(dir, "savvy")
+		assert.NoError(t, os.WriteFile(executable, []byte("old"), 0755))
+		assert.NoError(t, os.WriteFile(executable+".new", []byte("new"), 0755))
+		assert.NoError(t, install.NewTransaction(executable, install.Item{Source: executable + ".new", Target: executable}).Apply())
+		return executable
+	}
+
+	t.Run("Interrupted", func(t *testing.T) {
+		executable := interrupt(t)
+		assert.NoError(t, Recover(executable))
+		assert.NoFileExists(t, backupOf(executable))
+	})
+	t.Run("UpgradeInProgress", func(t *testing.T) {
+		executable := interrupt(t)
+		l, err := lock.Acquire(context.Background(), executable, 0)
+		assert.NoError(t, err)
+		defer l.Release()
+
+		// the upgrade holding the lock may still roll back, so its backup must be kept.
+		assert.NoError(t, Recover(executable))
+		assert.FileExists(t, backupOf(executable))
+	})
+}
+
+func TestCleanup(t *testing.T) {
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "savvy")
+	assert.NoError(t, os.WriteFile(executable, []byte("savvy"), 0755))
+	completions := t.TempDir()
+	// the temp files of an upgrade killed while installing a completion are named after the executable.
+	stale := []string{filepath.Join(dir, ".savvy.upgrade-1.tmp"), filepath.Join(completions, ".savvy.upgrade-2.tmp")}
+	old := time.Now().Add(-2 * install.DefaultStaleAge)
+	for _, path := range stale {
+		assert.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+		assert.NoError(t, os.Chtimes(path, old, old))
+	}
+
+	assert.NoError(t, Cleanup(context.Background(), executable, WithInstallPlan(
+		Artifact{Member: "savvy", Destination: "savvy"},
+		Artifact{Member: "_savvy", Destination: filepath.Join(completions, "_savvy")},
+	)))
+	for _, path := range stale {
+		assert.NoFileExists(t, path)
+	}
+}
@@ -0,0 +1,113 @@
+package verify
+
+import (
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+var (
+	// ErrNoBuildInfo means the candidate is not a Go binary or was built without module support.
+	ErrNoBuildInfo = errors.New("no go build info")
+	// ErrBuildInfoMismatch means the candidate's build info doesn't match the release.
+	ErrBuildInfoMismatch = errors.New("go build info mismatch")
+)
+
+// commitSHA matches abbreviated and full git commit hashes.
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+type buildInfoVerifier struct {
+	modulePath    string
+	checkVersion  bool
+	checkRevision bool
+}
+
+var _ Verifier = (*buildInfoVerifier)(nil)
+
+type BuildInfoOpt func(*buildInfoVerifier)
+
+// WithoutVersionCheck skips comparing the module version embedded in the candidate with the release's tag.
+//
+// Use it for binaries that are not built from a tagged module checkout, whose version is (devel).
+func WithoutVersionCheck() BuildInfoOpt {
+	return func(b *buildInfoVerifier) {
+		b.checkVersion = false
+	}
+}
+
+// WithRevisionCheck compares the candidate's vcs.revision with the commit the release was created from.
+//
+// The check is skipped if the release's target_commitish is a branch name rather than a commit.
+func WithRevisionCheck() BuildInfoOpt {
+	return func(b *buildInfoVerifier) {
+		b.checkRevision = true
+	}
+}
+
+// NewBuildInfoVerifier returns a Verifier that reads the Go build info of the candidate and checks
+// that its main module is modulePath and that its version matches the release's tag.
+func NewBuildInfoVerifier(modulePath string, opts ...BuildInfoOpt) Verifier {
+	b := &buildInfoVerifier{
+		modulePath:   modulePath,
+		checkVersion: true,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *buildInfoVerifier) Verify(ctx context.Context, c Candidate) error {
+	info, err := buildinfo.ReadFile(c.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrNoBuildInfo, c.Path, err)
+	}
+
+	if info.Main.Path != b.modulePath {
+		return fmt.Errorf("%w: main module is %q, expected %q", ErrBuildInfoMismatch, info.Main.Path, b.modulePath)
+	}
+
+	if b.checkVersion && !sameVersion(info.Main.Version, c.Version) {
+		return fmt.Errorf("%w: module version is %q, expected %q", ErrBuildInfoMismatch, info.Main.Version, c.Version)
+	}
+
+	if b.checkRevision && c.Release != nil && commitSHA.MatchString(c.Release.TargetCommitish) {
+		var revision string
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				revision = setting.Value
+			}
+		}
+		if !sameRevision(revision, c.Release.TargetCommitish) {
+			return fmt.Errorf("%w: vcs.revision is %q, expected %q", ErrBuildInfoMismatch, revision, c.Release.TargetCommitish)
+		}
+	}
+	return nil
+}
+
+// sameVersion reports whether the module version embedded in a binary matches a release tag.
+func sameVersion(moduleVersion, tag string) bool {
+	mv, err := version.NewVersion(moduleVersion)
+	if err != nil {
+		return false
+	}
+	tv, err := version.NewVersion(tag)
+	if err != nil {
+		return strings.TrimPrefix(moduleVersion, "v") == strings.TrimPrefix(tag, "v")
+	}
+	return mv.Equal(tv)
+}
+
+// sameRevision reports whether two, possibly abbreviated, commit hashes refer to the same commit.
+func sameRevision(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
@@ -0,0 +1,95 @@
+package verify
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildInfoVerifier(t *testing.T) {
+	ctx := context.Background()
+	// the test binary is built from this module, without a version.
+	testBinary, err := os.Executable()
+	assert.NoError(t, err)
+	const module = "github.com/getsavvyinc/upgrade-cli"
+
+	t.Run("MatchingModule", func(t *testing.T) {
+		v := NewBuildInfoVerifier(module, WithoutVersionCheck())
+		assert.NoError(t, v.Verify(ctx, Candidate{Path: testBinary, Version: "v1.2.3"}))
+	})
+	t.Run("DifferentModule", func(t *testing.T) {
+		v := NewBuildInfoVerifier("github.com/getsavvyinc/savvy-cli", WithoutVersionCheck())
+		err := v.Verify(ctx, Candidate{Path: testBinary, Version: "v1.2.3"})
+		assert.ErrorIs(t, err, ErrBuildInfoMismatch)
+	})
+	t.Run("DevelVersion", func(t *testing.T) {
+		v := NewBuildInfoVerifier(module)
+		err := v.Verify(ctx, Candidate{Path: testBinary, Version: "v1.2.3"})
+		assert.ErrorIs(t, err, ErrBuildInfoMismatch)
+	})
+	t.Run("RevisionCheckSkippedForBranches", func(t *testing.T) {
+		v := NewBuildInfoVerifier(module, WithoutVersionCheck(), WithRevisionCheck())
+		err := v.Verify(ctx, Candidate{Path: testBinary, Release: &release.Info{TargetCommitish: "main"}})
+		assert.NoError(t, err)
+	})
+	t.Run("Revision", func(t *testing.T) {
+		path, revision := buildFixture(t)
+		v := NewBuildInfoVerifier("example.com/fixture", WithoutVersionCheck(), WithRevisionCheck())
+		assert.NoError(t, v.Verify(ctx, Candidate{Path: path, Release: &release.Info{TargetCommitish: revision}}))
+		assert.NoError(t, v.Verify(ctx, Candidate{Path: path, Release: &release.Info{TargetCommitish: revision[:7]}}))
+
+		other := strings.Repeat("0", len(revision))
+		err := v.Verify(ctx, Candidate{Path: path, Release: &release.Info{TargetCommitish: other}})
+		assert.ErrorIs(t, err, ErrBuildInfoMismatch)
+	})
+	t.Run("NotAGoBinary", func(t *testing.T) {
+		path := writeFile(t, []byte("#!/bin/sh\necho hello\n"))
+		err := NewBuildInfoVerifier(module).Verify(ctx, Candidate{Path: path})
+		assert.ErrorIs(t, err, ErrNoBuildInfo)
+	})
+}
+
+func TestSameVersion(t *testing.T) {
+	assert.True(t, sameVersion("v1.2.3", "v1.2.3"))
+	assert.True(t, sameVersion("v1.2.3", "1.2.3"))
+	assert.False(t, sameVersion("v1.2.4", "v1.2.3"))
+	assert.False(t, sameVersion("v1.2.3-0.20240101000000-abcdef123456", "v1.2.3"))
+	assert.False(t, sameVersion("(devel)", "v1.2.3"))
+}
+
+// buildFixture builds a Go binary from a new git repository, and returns its path and the
+// revision it is stamped with.
+func buildFixture(t *testing.T) (string, string) {
+	t.Helper()
+	for _, tool := range []string{"go", "git"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found", tool)
+		}
+	}
+	dir := t.TempDir()
+	run := func(name string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command(name, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOFLAGS=-buildvcs=true", "GIT_CONFIG_GLOBAL="+os.DevNull)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s %s: %v: %s", name, strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/fixture\n\ngo 1.21\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	run("git", "init", "-q")
+	run("git", "add", ".")
+	run("git", "-c", "user.name=fixture", "-c", "user.email=fixture@example.com", "commit", "-q", "-m", "fixture")
+	path := filepath.Join(dir, "fixture")
+	run("go", "build", "-o", path, ".")
+	return path, run("git", "rev-parse", "HEAD")
+}
@@ -0,0 +1,193 @@
+package verify
+
+import (
+	"context"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/platform"
+)
+
+var (
+	// ErrUnknownFormat means the candidate is not an ELF, Mach-O or PE executable.
+	ErrUnknownFormat = errors.New("unknown executable format")
+	// ErrFormatMismatch means the candidate's format doesn't match the target OS, e.g a PE file on linux.
+	ErrFormatMismatch = errors.New("executable format mismatch")
+	// ErrArchMismatch means the candidate was built for a different architecture.
+	ErrArchMismatch = errors.New("executable architecture mismatch")
+)
+
+// Executable formats.
+const (
+	ELF   = "elf"
+	MachO = "mach-o"
+	PE    = "pe"
+)
+
+// FormatError describes a candidate whose format or architecture doesn't match the target platform.
+type FormatError struct {
+	// Err is one of ErrUnknownFormat, ErrFormatMismatch or ErrArchMismatch.
+	Err  error
+	Path string
+	Want platform.Platform
+	// Format is the detected executable format.
+	Format string
+	// Archs are the detected architectures. Universal binaries have more than one.
+	Archs []string
+}
+
+func (e *FormatError) Error() string {
+	if e.Format == "" {
+		return fmt.Sprintf("%s: %s", e.Err, e.Path)
+	}
+	return fmt.Sprintf("%s: %s is a %s executable for %s, want %s", e.Err, e.Path, e.Format, strings.Join(e.Archs, ", "), e.Want)
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+type formatVerifier struct{}
+
+var _ Verifier = (*formatVerifier)(nil)
+
+// NewFormatVerifier returns a Verifier that checks the candidate is an executable for the candidate's platform.
+//
+// ELF, Mach-O (including universal binaries) and PE files are supported.
+func NewFormatVerifier() Verifier {
+	return &formatVerifier{}
+}
+
+func (f *formatVerifier) Verify(ctx context.Context, c Candidate) error {
+	format, archs, err := detectFormat(c.Path)
+	if err != nil {
+		return err
+	}
+	ferr := &FormatError{Path: c.Path, Want: c.Platform, Format: format, Archs: archs}
+	if format == "" {
+		ferr.Err = ErrUnknownFormat
+		return ferr
+	}
+	if want := formatForOS(c.Platform.OS); want != "" && want != format {
+		ferr.Err = ErrFormatMismatch
+		return ferr
+	}
+	if !slices.Contains(archs, c.Platform.Arch) {
+		ferr.Err = ErrArchMismatch
+		return ferr
+	}
+	return nil
+}
+
+// formatForOS returns the executable format used by os, or an empty string if it is unknown.
+func formatForOS(os string) string {
+	switch os {
+	case "darwin", "ios":
+		return MachO
+	case "windows":
+		return PE
+	case "linux", "android", "freebsd", "netbsd", "openbsd", "dragonfly", "solaris", "illumos":
+		return ELF
+	}
+	return ""
+}
+
+// detectFormat returns the executable format of the file at path and the GOARCH values it can run on.
+//
+// It returns an empty format if the file is not a recognised executable.
+func detectFormat(path string) (string, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	if f, err := elf.NewFile(file); err == nil {
+		return ELF, []string{elfArch(f)}, nil
+	}
+	if f, err := macho.NewFatFile(file); err == nil {
+		var archs []string
+		for _, arch := range f.Arches {
+			archs = append(archs, machoArch(arch.Cpu))
+		}
+		return MachO, archs, nil
+	}
+	if f, err := macho.NewFile(file); err == nil {
+		return MachO, []string{machoArch(f.Cpu)}, nil
+	}
+	if f, err := pe.NewFile(file); err == nil {
+		return PE, []string{peArch(f.Machine)}, nil
+	}
+	return "", nil, nil
+}
+
+func elfArch(f *elf.File) string {
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_386:
+		return "386"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_RISCV:
+		return "riscv64"
+	case elf.EM_PPC64:
+		if f.ByteOrder == binary.LittleEndian {
+			return "ppc64le"
+		}
+		return "ppc64"
+	case elf.EM_S390:
+		return "s390x"
+	case elf.EM_LOONGARCH:
+		return "loong64"
+	case elf.EM_MIPS:
+		arch := "mips"
+		if f.Class == elf.ELFCLASS64 {
+			arch += "64"
+		}
+		if f.ByteOrder == binary.LittleEndian {
+			arch += "le"
+		}
+		return arch
+	}
+	return f.Machine.String()
+}
+
+func machoArch(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.Cpu386:
+		return "386"
+	case macho.CpuArm64:
+		return "arm64"
+	case macho.CpuArm:
+		return "arm"
+	case macho.CpuPpc64:
+		return "ppc64"
+	}
+	return cpu.String()
+}
+
+func peArch(machine uint16) string {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "amd64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "386"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "arm64"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return "arm"
+	}
+	return fmt.Sprintf("0x%x", machine)
+}
@@ -0,0 +1,136 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"debug/macho"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/platform"
+	"github.com/stretchr/testify/assert"
+)
+
+// machoHeader returns a minimal 64-bit Mach-O executable for cpu without any load commands.
+func machoHeader(cpu macho.Cpu) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, macho.FileHeader{
+		Magic: macho.Magic64,
+		Cpu:   cpu,
+		Type:  macho.TypeExec,
+	})
+	// reserved field of the 64-bit header
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	return buf.Bytes()
+}
+
+// machoFat returns a minimal universal binary containing a Mach-O executable for every cpu.
+func machoFat(cpus ...macho.Cpu) []byte {
+	const align = 12
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, []uint32{macho.MagicFat, uint32(len(cpus))})
+
+	offset := uint32(1 << align)
+	var bodies [][]byte
+	for _, cpu := range cpus {
+		body := machoHeader(cpu)
+		binary.Write(&buf, binary.BigEndian, macho.FatArchHeader{
+			Cpu:    cpu,
+			Offset: offset,
+			Size:   uint32(len(body)),
+			Align:  align,
+		})
+		bodies = append(bodies, body)
+		offset += 1 << align
+	}
+	for _, body := range bodies {
+		buf.Write(make([]byte, (1<<align)-buf.Len()%(1<<align)))
+		buf.Write(body)
+	}
+	return buf.Bytes()
+}
+
+func writeFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "candidate")
+	assert.NoError(t, os.WriteFile(path, data, 0755))
+	return path
+}
+
+func TestFormatVerifier(t *testing.T) {
+	ctx := context.Background()
+	v := NewFormatVerifier()
+
+	t.Run("CurrentExecutable", func(t *testing.T) {
+		// the test binary is an executable for the platform the tests run on.
+		path, err := os.Executable()
+		assert.NoError(t, err)
+		current := platform.New(runtime.GOOS, runtime.GOARCH)
+		assert.NoError(t, v.Verify(ctx, Candidate{Path: path, Platform: current}))
+
+		other := current
+		other.Arch = "s390x"
+		err = v.Verify(ctx, Candidate{Path: path, Platform: other})
+		assert.ErrorIs(t, err, ErrArchMismatch)
+		var ferr *FormatError
+		if assert.ErrorAs(t, err, &ferr) {
+			assert.Equal(t, []string{current.Arch}, ferr.Archs)
+		}
+	})
+
+	testCases := []struct {
+		name     string
+		data     []byte
+		platform platform.Platform
+		err      error
+	}{
+		{
+			name:     "MachO",
+			data:     machoHeader(macho.CpuArm64),
+			platform: platform.New("darwin", "arm64"),
+		},
+		{
+			name:     "MachOWrongArch",
+			data:     machoHeader(macho.CpuArm64),
+			platform: platform.New("darwin", "amd64"),
+			err:      ErrArchMismatch,
+		},
+		{
+			name:     "MachOOnLinux",
+			data:     machoHeader(macho.CpuAmd64),
+			platform: platform.New("linux", "amd64"),
+			err:      ErrFormatMismatch,
+		},
+		{
+			name:     "UniversalBinary",
+			data:     machoFat(macho.CpuAmd64, macho.CpuArm64),
+			platform: platform.New("darwin", "arm64"),
+		},
+		{
+			name:     "UniversalBinaryWithoutArch",
+			data:     machoFat(macho.CpuAmd64),
+			platform: platform.New("darwin", "arm64"),
+			err:      ErrArchMismatch,
+		},
+		{
+			name:     "ShellScript",
+			data:     []byte("#!/bin/sh\necho hello\n"),
+			platform: platform.New("linux", "amd64"),
+			err:      ErrUnknownFormat,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeFile(t, tc.data)
+			err := v.Verify(ctx, Candidate{Path: path, Platform: tc.platform})
+			if tc.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var ErrSmokeTestFailed = errors.New("smoke test failed")
+
+type smokeTester struct {
+	args          []string
+	timeout       time.Duration
+	expectVersion bool
+}
+
+var _ Verifier = (*smokeTester)(nil)
+
+type SmokeTestOpt func(*smokeTester)
+
+// WithArgs sets the arguments the candidate is run with. It defaults to --version.
+func WithArgs(args ...string) SmokeTestOpt {
+	return func(s *smokeTester) {
+		s.args = args
+	}
+}
+
+// WithTimeout limits how long the candidate may run. It defaults to 10 seconds.
+func WithTimeout(d time.Duration) SmokeTestOpt {
+	return func(s *smokeTester) {
+		s.timeout = d
+	}
+}
+
+// WithExpectVersion requires the candidate's output to contain the version being installed.
+func WithExpectVersion() SmokeTestOpt {
+	return func(s *smokeTester) {
+		s.expectVersion = true
+	}
+}
+
+// NewSmokeTester returns a Verifier that runs the candidate and checks that it exits successfully.
+func NewSmokeTester(opts ...SmokeTestOpt) Verifier {
+	s := &smokeTester{
+		args:    []string{"--version"},
+		timeout: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *smokeTester) Verify(ctx context.Context, c Candidate) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Path, s.args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// don't wait for grandchildren that inherited the output pipes once the candidate has been killed.
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%w: %s timed out after %s", ErrSmokeTestFailed, strings.Join(cmd.Args, " "), s.timeout)
+		}
+		return fmt.Errorf("%w: %s: %w: %s", ErrSmokeTestFailed, strings.Join(cmd.Args, " "), err, truncate(output.String()))
+	}
+
+	if s.expectVersion && !containsVersion(output.String(), c.Version) {
+		return fmt.Errorf("%w: output of %s does not contain version %s: %s", ErrSmokeTestFailed, strings.Join(cmd.Args, " "), c.Version, truncate(output.String()))
+	}
+	return nil
+}
+
+// containsVersion reports whether output mentions version, with or without a leading v.
+//
+// The version must be a whole token, so that e.g 1.2.3 doesn't match 1.2.30, 11.2.3 or 1.2.3-rc1.
+func containsVersion(output, version string) bool {
+	version = strings.TrimPrefix(version, "v")
+	if version == "" {
+		return false
+	}
+	re := regexp.MustCompile(`(?:^|[^[:alnum:].])[vV]?` + regexp.QuoteMeta(version) + `(?:$|[^[:alnum:].-]|[.-](?:$|[^[:alnum:]]))`)
+	return re.MatchString(output)
+}
+
+// truncate shortens output so that it can be included in an error.
+func truncate(output string) string {
+	const max = 512
+	output = strings.TrimSpace(output)
+	if len(output) > max {
+		return output[:max] + "..."
+	}
+	return output
+}
@@ -0,0 +1,95 @@
+package verify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeScript writes an executable shell script to a temporary directory and returns its path.
+func writeScript(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not executable on windows")
+	}
+	path := filepath.Join(t.TempDir(), "candidate")
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755)
+	assert.NoError(t, err)
+	return path
+}
+
+func TestSmokeTester(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		name    string
+		script  string
+		opts    []SmokeTestOpt
+		wantErr bool
+	}{
+		{
+			name:   "Succeeds",
+			script: `echo "savvy version 1.2.3"`,
+		},
+		{
+			name:   "SucceedsWithExpectedVersion",
+			script: `echo "savvy version 1.2.3"`,
+			opts:   []SmokeTestOpt{WithExpectVersion()},
+		},
+		{
+			name:   "CustomArgs",
+			script: `[ "$1" = "version" ] && [ "$2" = "--short" ]`,
+			opts:   []SmokeTestOpt{WithArgs("version", "--short")},
+		},
+		{
+			name:    "NonZeroExit",
+			script:  `echo "error while loading shared libraries" >&2; exit 127`,
+			wantErr: true,
+		},
+		{
+			name:    "WrongVersion",
+			script:  `echo "savvy version 1.2.2"`,
+			opts:    []SmokeTestOpt{WithExpectVersion()},
+			wantErr: true,
+		},
+		{
+			name:    "VersionPrefix",
+			script:  `echo "savvy version 1.2.30"`,
+			opts:    []SmokeTestOpt{WithExpectVersion()},
+			wantErr: true,
+		},
+		{
+			name:    "PrereleaseVersion",
+			script:  `echo "savvy v1.2.3-rc1"`,
+			opts:    []SmokeTestOpt{WithExpectVersion()},
+			wantErr: true,
+		},
+		{
+			name:   "VersionWithPrefixAndPunctuation",
+			script: `echo "savvy (v1.2.3, linux/amd64)."`,
+			opts:   []SmokeTestOpt{WithExpectVersion()},
+		},
+		{
+			name:    "Timeout",
+			script:  `sleep 5`,
+			opts:    []SmokeTestOpt{WithTimeout(100 * time.Millisecond)},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeScript(t, tc.script)
+			err := NewSmokeTester(tc.opts...).Verify(ctx, Candidate{Path: path, Version: "v1.2.3"})
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrSmokeTestFailed)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
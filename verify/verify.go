@@ -0,0 +1,27 @@
+package verify
+
+import (
+	"context"
+
+	"github.com/getsavvyinc/upgrade-cli/platform"
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// Candidate is a downloaded binary that is about to replace the current executable.
+type Candidate struct {
+	// Path is the location of the downloaded binary.
+	Path string
+	// Version is the version the candidate is expected to report, i.e the release's tag.
+	Version string
+	// Platform is the platform the candidate was selected for.
+	Platform platform.Platform
+	// Release is the release the candidate was downloaded from.
+	Release *release.Info
+}
+
+// Verifier checks a candidate before it is installed.
+//
+// A Verifier must not modify the candidate.
+type Verifier interface {
+	Verify(ctx context.Context, c Candidate) error
+}